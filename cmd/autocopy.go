@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var autoCopyAll bool
+
+var autoCopyCmd = &cobra.Command{
+	Use:   "auto-copy",
+	Short: "List the ignored files --auto-copy would bring into new trees, without copying anything",
+	Long: `List the ignored files --auto-copy would bring into new trees, without copying anything.
+
+Files are found with git ls-files --others --ignored --exclude-standard, then filtered by the include and exclude
+globs of [auto_copy] in config.toml. Heavy directories like node_modules are always skipped.`,
+	Args: cobra.NoArgs,
+	Run:  handleAutoCopy,
+}
+
+func init() {
+	autoCopyCmd.Flags().BoolVar(&autoCopyAll, "all", false, "also list the ignored files that would be skipped, and why")
+	autoCopyCmd.Flags().StringArrayVar(&copyFiles, "copy", []string{}, "paths that would be given with --copy, which auto-copy leaves to them")
+	rootCmd.AddCommand(autoCopyCmd)
+}
+
+func handleAutoCopy(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	candidates, err := treeai.AutoCopyCandidates(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if autoCopyAll {
+		fmt.Fprintln(w, "PATH\tACTION")
+	}
+	for _, c := range candidates {
+		switch {
+		case c.Skip == "" && autoCopyAll:
+			fmt.Fprintf(w, "%s\t%s\n", c.Path, cfg.AutoCopy.Mode)
+		case c.Skip == "":
+			fmt.Fprintln(w, c.Path)
+		case autoCopyAll:
+			fmt.Fprintf(w, "%s\tskip: %s\n", c.Path, c.Skip)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var compareDiff []string
+
+var compareCmd = &cobra.Command{
+	Use:   "compare [worktree-name...]",
+	Short: "Compare the changes made by sibling trees",
+	Long: `Show each tree's diffstat against the merge base the trees share, and the files that only some of the trees changed.
+
+Pass the base name of a fan-out to compare all of its trees. With no names, every tree for the repository is compared. Only committed changes are compared.`,
+	Run: handleCompare,
+}
+
+func init() {
+	compareCmd.Flags().StringSliceVar(&compareDiff, "diff", []string{}, "show the full diff between the branch tips of two trees, as --diff from,to")
+	rootCmd.AddCommand(compareCmd)
+}
+
+func handleCompare(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	if len(compareDiff) > 0 {
+		if len(compareDiff) != 2 {
+			fmt.Fprintf(os.Stderr, "Error: --diff needs the names of exactly two trees\n")
+			os.Exit(1)
+		}
+		diff, err := treeai.DiffWorktrees(cfg, compareDiff[0], compareDiff[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(diff)
+		return
+	}
+
+	comparison, err := treeai.CompareWorktrees(cfg, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Merge base: %s\n", shortHash(comparison.MergeBase))
+	for _, tree := range comparison.Trees {
+		if tree.Branch != "" {
+			fmt.Printf("\n%s (%s)", tree.Name, tree.Branch)
+		} else {
+			fmt.Printf("\n%s (detached at %s)", tree.Name, shortHash(tree.Rev))
+		}
+		if tree.Dirty {
+			fmt.Print(", has uncommitted changes that are not compared")
+		}
+		fmt.Println()
+		if tree.Stat == "" {
+			fmt.Println("  no changes")
+			continue
+		}
+		for _, line := range strings.Split(tree.Stat, "\n") {
+			fmt.Printf("  %s\n", strings.TrimSpace(line))
+		}
+	}
+
+	fmt.Println()
+	if len(comparison.Partial) == 0 {
+		fmt.Println("Every changed file was changed by all trees")
+		return
+	}
+
+	fmt.Println("Files changed by only some trees:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := []string{"FILE"}
+	for _, tree := range comparison.Trees {
+		header = append(header, tree.Name)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, file := range comparison.Partial {
+		row := []string{file}
+		for _, touched := range comparison.Touched(file) {
+			mark := "-"
+			if touched {
+				mark = "x"
+			}
+			row = append(row, mark)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
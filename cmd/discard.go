@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var discardForce bool
+
+var discardCmd = &cobra.Command{
+	Use:     "discard <worktree-name>",
+	Aliases: []string{"remove", "rm"},
+	Short:   "Abandon a worktree without merging, deleting its branch and tmux session",
+	Args:    cobra.ExactArgs(1),
+	Run:     handleDiscard,
+}
+
+func init() {
+	discardCmd.Flags().BoolVar(&discardForce, "force", false, "discard uncommitted changes and unmerged commits without confirmation")
+	rootCmd.AddCommand(discardCmd)
+}
+
+func handleDiscard(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+	treeai.DiscardWorktree(cfg, args[0], discardForce)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	promptpkg "github.com/jesses-code-adventures/treeai/prompt"
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var fanoutCount int
+var fanoutAgents []string
+
+var fanoutCmd = &cobra.Command{
+	Use:   "fanout <base-name>",
+	Short: "Create several trees from the same prompt, for best-of-N attempts",
+	Long: `Create <base-name>-1 to <base-name>-N worktrees concurrently, each with its own agent session and the same prompt, without switching to any of them.
+
+Repeat --agent to spread the trees across several agents in turn.`,
+	Args: cobra.ExactArgs(1),
+	Run:  handleFanout,
+}
+
+func init() {
+	fanoutCmd.Flags().IntVarP(&fanoutCount, "count", "n", 2, "number of trees to create")
+	fanoutCmd.Flags().StringArrayVar(&fanoutAgents, "agent", []string{}, "agent profile to launch, repeat to assign agents to the trees in turn")
+	fanoutCmd.Flags().StringVar(&prompt, "prompt", "", "send a prompt to every agent, or - to read it from stdin")
+	fanoutCmd.Flags().StringVar(&promptFile, "prompt-file", "", "read the prompt from a file, or - for stdin")
+	fanoutCmd.Flags().StringVar(&promptTemplate, "template", "", "render each tree's prompt from a named template in config.toml, with --prompt available as {{.Prompt}} and the tree's name as {{.Branch}}")
+	fanoutCmd.Flags().StringArrayVar(&templateVars, "var", []string{}, "set a template variable, as key=value")
+	fanoutCmd.Flags().BoolVarP(&edit, "edit", "e", false, "write the prompt in $EDITOR, starting from --prompt or --prompt-file if given. With --template, this is the {{.Prompt}} rendered into it")
+	fanoutCmd.Flags().StringVar(&promptVia, "prompt-via", "", "override how the agents receive the prompt: send-keys, arg, stdin or file")
+	fanoutCmd.Flags().StringVar(&from, "from", "", "branch, tag, commit or other ref to start every tree from, instead of HEAD")
+	fanoutCmd.Flags().StringVar(&base, "base", "", "branch to merge the trees back into (default the --from branch, or the current branch)")
+	fanoutCmd.Flags().BoolVar(&headless, "headless", false, "run the agents as detached background processes logging to the data directory, instead of in tmux sessions")
+	fanoutCmd.Flags().BoolVar(&window, "window", false, "open a tmux window per tree, instead of a session")
+	fanoutCmd.Flags().StringArrayVar(&commands, "command", []string{}, "add an additional tmux window per command to every tree")
+	fanoutCmd.Flags().StringArrayVar(&copyFiles, "copy", []string{}, "copy gitignored files, directories or globs to every worktree, as path[:copy|symlink|hardlink|reflink]")
+	fanoutCmd.Flags().BoolVar(&autoCopy, "auto-copy", false, "copy the files git ignores in the git root to every worktree, filtered by [auto_copy] in config.toml")
+	fanoutCmd.Flags().StringVar(&bin, "bin", "", "binary to launch in every tree, instead of an agent profile")
+	fanoutCmd.Flags().BoolVar(&notifyIdle, "notify", false, "notify as each agent goes idle or stops, using the notifiers in config.toml")
+	fanoutCmd.Flags().BoolVar(&gitignore, "gitignore", false, "use .gitignore instead of .git/info/exclude to exclude worktrees from git")
+	rootCmd.AddCommand(fanoutCmd)
+}
+
+func handleFanout(cmd *cobra.Command, args []string) {
+	baseName := args[0]
+	cfg := loadConfig()
+
+	if headless && (window || len(commands) > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --window and --command need a multiplexer and cannot be used with --headless\n")
+		os.Exit(1)
+	}
+
+	p, err := fanoutPrompt(cfg, baseName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	results, err := treeai.Fanout(cfg, baseName, fanoutCount, fanoutAgents, p)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tAGENT\tSESSION\tSTATUS\tPATH")
+	for _, r := range results {
+		session, path, status := "-", "-", "created"
+		if r.Tree != nil {
+			path = r.Tree.Path
+			if r.Tree.Session != "" {
+				session = r.Tree.Session
+			} else if r.Tree.Headless != nil {
+				session = "headless"
+			}
+		}
+		if r.Err != nil {
+			status = "failed"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Agent, session, status, path)
+	}
+	w.Flush()
+
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", r.Name, r.Err)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// fanoutPrompt returns the prompt for each tree of a fan-out. Templates are rendered per tree, so .Branch is the
+// tree's own name, which means --edit edits the prompt given to the template rather than what it renders.
+func fanoutPrompt(cfg *config.Config, baseName string) (func(string) (string, error), error) {
+	text, source, err := readPrompt()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(templateVars) > 0 && promptTemplate == "" {
+		return nil, fmt.Errorf("--var can only be used with --template")
+	}
+	vars, err := promptpkg.ParseVars(templateVars)
+	if err != nil {
+		return nil, err
+	}
+
+	if edit {
+		if source == "-" {
+			return nil, fmt.Errorf("--edit cannot be used with a prompt read from stdin")
+		}
+		instructions := fmt.Sprintf("Enter the prompt for the agents in '%s-1' to '%s-%d'. An empty prompt aborts.", baseName, baseName, fanoutCount)
+		if promptTemplate != "" {
+			instructions += fmt.Sprintf("\nIt is rendered into the '%s' template for each tree as {{.Prompt}}.", promptTemplate)
+		}
+		if text, err = promptpkg.Edit(text, instructions); err != nil {
+			return nil, err
+		}
+		if text == "" {
+			return nil, fmt.Errorf("aborting due to empty prompt")
+		}
+	}
+
+	return func(name string) (string, error) {
+		if promptTemplate == "" {
+			return text, nil
+		}
+		return treeai.RenderPromptTemplate(cfg, promptTemplate, name, text, vars)
+	}, nil
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var gcYes bool
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Find and clean up orphaned worktrees, branches and tmux sessions",
+	Long: `gc runs git worktree prune, then cross-references git's worktrees, the data directory, the tree registry and tmux sessions.
+
+Each inconsistency is reported and fixed after confirmation, or immediately with --yes.`,
+	Args: cobra.NoArgs,
+	Run:  handleGC,
+}
+
+func init() {
+	gcCmd.Flags().BoolVarP(&gcYes, "yes", "y", false, "fix every issue without asking for confirmation")
+	rootCmd.AddCommand(gcCmd)
+}
+
+func handleGC(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+	treeai.GarbageCollect(cfg, gcYes)
+}
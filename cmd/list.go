@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List every worktree for the current repository and its live state",
+	Args:  cobra.NoArgs,
+	Run:   handleList,
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
+
+func handleList(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	statuses, err := treeai.ListWorktrees(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No worktrees found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tBRANCH\tBASE\tAHEAD\tBEHIND\tDIRTY\tAGENT\tSESSION\tPATH")
+	for _, s := range statuses {
+		session := "-"
+		if s.Alive {
+			session = s.Session
+		} else if s.ExitCode != nil {
+			session = fmt.Sprintf("exited %d", *s.ExitCode)
+		}
+		dirty := "no"
+		if s.Dirty {
+			dirty = "yes"
+		}
+		if s.Err != nil {
+			dirty = "?"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n", s.Name, s.Branch, s.Base, s.Ahead, s.Behind, dirty, s.AgentState(), session, s.Path)
+	}
+	w.Flush()
+
+	for _, s := range statuses {
+		if s.Err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", s.Name, s.Err)
+		}
+	}
+}
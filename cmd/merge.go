@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var mergeContinue bool
+var mergeAbort bool
+var mergeResolveWithAgent bool
+var mergeCheck bool
+var mergeInto string
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <worktree-name>",
+	Short: "Merge a worktree back into its base branch and clean up",
+	Long: `merge brings a worktree's branch into the branch it was created from, then removes the worktree, its branch and its tmux session.
+
+If the merge stops on conflicts it is paused: the conflicted files are listed in a new tmux window in the tree,
+and the merge can be resumed with --continue once they are resolved, or rolled back with --abort.`,
+	Args: cobra.ExactArgs(1),
+	Run:  handleMerge,
+}
+
+func init() {
+	mergeCmd.Flags().BoolVar(&mergeContinue, "continue", false, "resume a merge that stopped on conflicts")
+	mergeCmd.Flags().BoolVar(&mergeAbort, "abort", false, "abandon a merge that stopped on conflicts and restore the pre-merge state")
+	mergeCmd.Flags().BoolVar(&mergeResolveWithAgent, "resolve-with-agent", false, "ask the tree's agent to resolve any conflicts")
+	mergeCmd.Flags().StringVar(&strategy, "strategy", "", "merge strategy: rebase-ff, squash, no-ff or cherry-pick (default rebase-ff)")
+	mergeCmd.Flags().StringVar(&mergeInto, "into", "", "branch to merge into, switching the git root to it first (default the tree's base branch, which the git root must be on)")
+	mergeCmd.Flags().BoolVar(&mergeCheck, "check", false, "only report the files that would conflict, without touching anything")
+	mergeCmd.MarkFlagsMutuallyExclusive("continue", "abort", "check")
+	rootCmd.AddCommand(mergeCmd)
+}
+
+func handleMerge(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	if (mergeContinue || mergeAbort) && strategy != "" {
+		fmt.Fprintf(os.Stderr, "Error: --strategy cannot be changed while resuming or aborting a merge\n")
+		os.Exit(1)
+	}
+	if (mergeContinue || mergeAbort || mergeCheck) && mergeInto != "" {
+		fmt.Fprintf(os.Stderr, "Error: --into can only be used when starting a merge\n")
+		os.Exit(1)
+	}
+
+	switch {
+	case mergeCheck:
+		treeai.CheckMerge(cfg, args[0])
+	case mergeContinue:
+		treeai.ContinueMerge(cfg, args[0], mergeResolveWithAgent)
+	case mergeAbort:
+		treeai.AbortMerge(cfg, args[0])
+	default:
+		treeai.MergeWorktree(cfg, args[0], mergeInto, mergeResolveWithAgent)
+	}
+}
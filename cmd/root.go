@@ -3,9 +3,11 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/jesses-code-adventures/treeai/config"
 	l "github.com/jesses-code-adventures/treeai/logger"
+	promptpkg "github.com/jesses-code-adventures/treeai/prompt"
 	"github.com/jesses-code-adventures/treeai/treeai"
 	"github.com/spf13/cobra"
 )
@@ -17,9 +19,23 @@ var commands []string
 var copyFiles []string
 var bin string
 var prompt string
+var promptFile string
+var edit bool
+var promptTemplate string
+var templateVars []string
 var gitignore bool
 var window bool
 var debug bool
+var strategy string
+var multiplexer string
+var headless bool
+var agent string
+var promptVia string
+var notifyIdle bool
+var autoCopy bool
+var from string
+var base string
+var checkoutExisting bool
 
 var rootCmd = &cobra.Command{
 	Use:   "treeai <worktree-name>",
@@ -33,15 +49,29 @@ This tool requires tmux to be installed and is designed to work as a tmux plugin
 
 func init() {
 	rootCmd.Flags().BoolVar(&merge, "merge", false, "merge the worktree branch back to main and clean up")
-	rootCmd.Flags().BoolVar(&silent, "silent", false, "suppress all output")
+	rootCmd.PersistentFlags().BoolVar(&silent, "silent", false, "suppress all output")
 	rootCmd.Flags().BoolVar(&gitignore, "gitignore", false, "use .gitignore instead of .git/info/exclude to exclude worktrees from git")
 	rootCmd.Flags().BoolVar(&window, "window", false, "open a new tmux window with the worktree, instead of a session")
-	rootCmd.Flags().BoolVar(&debug, "debug", false, "use .gitignore instead of .git/info/exclude to exclude worktrees from git")
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "use .gitignore instead of .git/info/exclude to exclude worktrees from git")
+	rootCmd.Flags().StringVar(&strategy, "strategy", "", "merge strategy: rebase-ff, squash, no-ff or cherry-pick (default rebase-ff)")
+	rootCmd.Flags().BoolVar(&headless, "headless", false, "run the agent as a detached background process logging to the data directory, instead of in a tmux session")
+	rootCmd.Flags().StringVar(&from, "from", "", "branch, tag, commit or other ref to start the worktree branch from, instead of HEAD")
+	rootCmd.Flags().StringVar(&base, "base", "", "branch to merge the worktree back into (default the --from branch, or the current branch)")
+	rootCmd.Flags().BoolVar(&checkoutExisting, "checkout-existing", false, "open the worktree on an existing local or remote branch instead of creating a new one")
+	rootCmd.Flags().StringVar(&agent, "agent", "", "agent profile to launch in the worktree, from [agents.<name>] in config.toml (default opencode)")
+	rootCmd.Flags().StringVar(&promptVia, "prompt-via", "", "override how the agent receives the prompt: send-keys, arg, stdin or file")
 	rootCmd.Flags().StringArrayVar(&commands, "command", []string{}, "add an additional tmux window per command, running each command in a new window")
-	rootCmd.Flags().StringArrayVar(&copyFiles, "copy", []string{}, "copy gitignored files to the worktree")
-	rootCmd.Flags().StringVar(&bin, "bin", "opencode", "binary to launch in the tmux session")
-	rootCmd.Flags().StringVar(&prompt, "prompt", "", "send a prompt to opencode in the new session")
-	rootCmd.Flags().StringVar(&data, "data", os.ExpandEnv("$HOME/.local/share/treeai"), "path to data directory")
+	rootCmd.Flags().StringArrayVar(&copyFiles, "copy", []string{}, "copy gitignored files, directories or globs to the worktree, as path[:copy|symlink|hardlink|reflink]")
+	rootCmd.Flags().BoolVar(&autoCopy, "auto-copy", false, "copy the files git ignores in the git root to the worktree, filtered by [auto_copy] in config.toml")
+	rootCmd.Flags().StringVar(&bin, "bin", "", "binary to launch in the tmux session, instead of an agent profile")
+	rootCmd.Flags().StringVar(&prompt, "prompt", "", "send a prompt to the agent in the new session, or - to read it from stdin")
+	rootCmd.Flags().StringVar(&promptFile, "prompt-file", "", "read the prompt from a file, or - for stdin")
+	rootCmd.Flags().StringVar(&promptTemplate, "template", "", "render the prompt from a named template in config.toml, with --prompt available as {{.Prompt}}")
+	rootCmd.Flags().StringArrayVar(&templateVars, "var", []string{}, "set a template variable, as key=value")
+	rootCmd.Flags().BoolVarP(&edit, "edit", "e", false, "write the prompt in $EDITOR, starting from --prompt or --prompt-file if given")
+	rootCmd.Flags().BoolVar(&notifyIdle, "notify", false, "notify once the agent goes idle or stops, using the notifiers in config.toml")
+	rootCmd.PersistentFlags().StringVar(&multiplexer, "multiplexer", "", "terminal multiplexer to open trees in: tmux or screen (default tmux)")
+	rootCmd.PersistentFlags().StringVar(&data, "data", os.ExpandEnv("$HOME/.local/share/treeai"), "path to data directory")
 }
 
 func Execute() {
@@ -51,34 +81,158 @@ func Execute() {
 	}
 }
 
-func handleCommand(cmd *cobra.Command, args []string) {
-	branchName := args[0]
+func loadConfig() *config.Config {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
-	cfg.ApplyFlags(bin, silent, data, commands, copyFiles, gitignore, debug, window)
+	cfg.ApplyFlags(config.Flags{
+		Bin:              bin,
+		Silent:           silent,
+		Data:             data,
+		Commands:         commands,
+		Copy:             copyFiles,
+		Gitignore:        gitignore,
+		Debug:            debug,
+		Window:           window,
+		Strategy:         strategy,
+		Multiplexer:      multiplexer,
+		Headless:         headless,
+		Agent:            agent,
+		PromptVia:        promptVia,
+		NotifyIdle:       notifyIdle,
+		AutoCopy:         autoCopy,
+		From:             from,
+		Base:             base,
+		CheckoutExisting: checkoutExisting,
+	})
 	l.Init(cfg)
+	return cfg
+}
+
+func handleCommand(cmd *cobra.Command, args []string) {
+	branchName := args[0]
+	cfg := loadConfig()
 
 	if merge && len(commands) > 0 {
 		fmt.Fprintf(os.Stderr, "Error: cannot create a window when merging\n")
 		os.Exit(1)
 	}
 
-	if merge && prompt != "" {
-		fmt.Fprintf(os.Stderr, "Error: cannot use --prompt flag when merging\n")
+	if merge && (prompt != "" || promptFile != "" || edit || promptTemplate != "") {
+		fmt.Fprintf(os.Stderr, "Error: cannot use --prompt, --prompt-file, --template or --edit flags when merging\n")
+		os.Exit(1)
+	}
+
+	if !merge && strategy != "" {
+		fmt.Fprintf(os.Stderr, "Error: --strategy can only be used when merging\n")
+		os.Exit(1)
+	}
+
+	if merge && headless {
+		fmt.Fprintf(os.Stderr, "Error: cannot use --headless flag when merging\n")
+		os.Exit(1)
+	}
+
+	if headless && (window || len(commands) > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --window and --command need a multiplexer and cannot be used with --headless\n")
 		os.Exit(1)
 	}
 
-	if merge && bin != "opencode" {
+	if merge && bin != "" {
 		fmt.Fprintf(os.Stderr, "Error: cannot use --bin-name flag when merging\n")
 		os.Exit(1)
 	}
 
+	if merge && (agent != "" || promptVia != "" || notifyIdle || autoCopy) {
+		fmt.Fprintf(os.Stderr, "Error: cannot use --agent, --prompt-via, --notify or --auto-copy flags when merging\n")
+		os.Exit(1)
+	}
+
+	if merge && (from != "" || base != "" || checkoutExisting) {
+		fmt.Fprintf(os.Stderr, "Error: cannot use --from, --base or --checkout-existing flags when merging\n")
+		os.Exit(1)
+	}
+
+	if checkoutExisting && from != "" {
+		fmt.Fprintf(os.Stderr, "Error: --from and --checkout-existing cannot be used together\n")
+		os.Exit(1)
+	}
+
+	if agent != "" && bin != "" {
+		fmt.Fprintf(os.Stderr, "Error: --agent and --bin cannot be used together\n")
+		os.Exit(1)
+	}
+
 	if merge {
-		treeai.MergeWorktree(cfg, branchName)
-	} else {
-		treeai.CreateWorktree(cfg, branchName, prompt)
+		treeai.MergeWorktree(cfg, branchName, "", false)
+		return
+	}
+
+	p, err := resolvePrompt(cfg, branchName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	treeai.CreateWorktree(cfg, branchName, p)
+}
+
+// resolvePrompt returns the prompt for a new tree from --prompt or --prompt-file, rendered through --template
+// and then opened in the editor if asked
+func resolvePrompt(cfg *config.Config, branchName string) (string, error) {
+	text, source, err := readPrompt()
+	if err != nil {
+		return "", err
+	}
+
+	if len(templateVars) > 0 && promptTemplate == "" {
+		return "", fmt.Errorf("--var can only be used with --template")
+	}
+	if promptTemplate != "" {
+		vars, err := promptpkg.ParseVars(templateVars)
+		if err != nil {
+			return "", err
+		}
+		if text, err = treeai.RenderPromptTemplate(cfg, promptTemplate, branchName, text, vars); err != nil {
+			return "", err
+		}
+	}
+
+	if !edit {
+		return text, nil
+	}
+	if source == "-" {
+		return "", fmt.Errorf("--edit cannot be used with a prompt read from stdin")
+	}
+
+	text, err = promptpkg.Edit(text, fmt.Sprintf("Enter the prompt for the agent in '%s'. An empty prompt aborts.", branchName))
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", fmt.Errorf("aborting due to empty prompt")
+	}
+	return text, nil
+}
+
+// readPrompt returns the text of --prompt or --prompt-file, and the file it was read from, if any
+func readPrompt() (string, string, error) {
+	if prompt != "" && promptFile != "" {
+		return "", "", fmt.Errorf("--prompt and --prompt-file cannot be used together")
+	}
+
+	text := prompt
+	source := promptFile
+	if prompt == "-" {
+		source = "-"
+	}
+	if source != "" {
+		var err error
+		if text, err = promptpkg.Read(source); err != nil {
+			return "", "", err
+		}
+		text = strings.TrimRight(text, "\n")
 	}
+	return text, source, nil
 }
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/dashboard"
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var statusWatch bool
+var statusInterval time.Duration
+var statusNotify bool
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show every tree with its commits, agent and session",
+	Long: `Show every tree for the current repository with its branch, commits, last commit age, dirty state, agent state and session.
+
+With --watch, a full screen dashboard refreshes the table and can switch to, merge, discard or diff the selected tree.`,
+	Args: cobra.NoArgs,
+	Run:  handleStatus,
+}
+
+func init() {
+	statusCmd.Flags().BoolVarP(&statusWatch, "watch", "w", false, "show a live dashboard")
+	statusCmd.Flags().DurationVar(&statusInterval, "interval", 3*time.Second, "how often the dashboard refreshes")
+	statusCmd.Flags().BoolVar(&statusNotify, "notify", false, "with --watch, notify when an agent goes idle or stops, using the notifiers in config.toml")
+	rootCmd.AddCommand(statusCmd)
+}
+
+func handleStatus(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	if statusNotify && !statusWatch {
+		fmt.Fprintf(os.Stderr, "Error: --notify can only be used with --watch\n")
+		os.Exit(1)
+	}
+
+	if statusWatch {
+		if err := dashboard.Run(cfg, statusInterval, statusNotify); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	statuses, err := treeai.ListWorktrees(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No worktrees found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(dashboard.Header, "\t"))
+	now := time.Now()
+	for _, s := range statuses {
+		fmt.Fprintln(w, strings.Join(dashboard.Row(s, now), "\t"))
+	}
+	w.Flush()
+
+	for _, s := range statuses {
+		if s.Err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", s.Name, s.Err)
+		}
+	}
+}
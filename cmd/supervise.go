@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var superviseCmd = &cobra.Command{
+	Use:    "supervise <worktree-path>",
+	Short:  "Run a headless tree's agent and record how it exits",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	Run:    handleSupervise,
+}
+
+func init() {
+	rootCmd.AddCommand(superviseCmd)
+}
+
+func handleSupervise(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+	treeai.Supervise(cfg, args[0])
+}
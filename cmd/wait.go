@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/treeai"
+	"github.com/spf13/cobra"
+)
+
+var waitTimeout time.Duration
+var waitInterval time.Duration
+var waitNotify bool
+
+var waitCmd = &cobra.Command{
+	Use:   "wait <worktree-name>",
+	Short: "Block until a tree's agent is idle or has stopped",
+	Long: `Block until a tree's agent is idle or has stopped.
+
+An agent is idle once its output matches one of its profile's ready patterns, or has not changed for idle_after (10s by default).
+Exits 1 if --timeout elapses first.`,
+	Args: cobra.ExactArgs(1),
+	Run:  handleWait,
+}
+
+func init() {
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "give up after this long, 0 waits indefinitely")
+	waitCmd.Flags().DurationVar(&waitInterval, "interval", 2*time.Second, "how often to check the agent's output")
+	waitCmd.Flags().BoolVar(&waitNotify, "notify", false, "notify once the agent goes idle or stops, using the notifiers in config.toml")
+	rootCmd.AddCommand(waitCmd)
+}
+
+func handleWait(cmd *cobra.Command, args []string) {
+	cfg := loadConfig()
+
+	state, err := treeai.WaitForIdle(cfg, args[0], waitTimeout, waitInterval, waitNotify)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !cfg.Silent {
+		fmt.Printf("%s: %s\n", args[0], state)
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Prompt delivery methods
+const (
+	// PromptSendKeys types the prompt into the agent once it has started
+	PromptSendKeys = "send-keys"
+	// PromptArg passes the prompt as a command line argument
+	PromptArg = "arg"
+	// PromptStdin feeds the prompt to the agent on stdin
+	PromptStdin = "stdin"
+	// PromptFile writes the prompt to a file and passes its path as a command line argument
+	PromptFile = "file"
+)
+
+var promptMethods = []string{PromptSendKeys, PromptArg, PromptStdin, PromptFile}
+
+// Agent is a coding agent that can be launched in a tree, configured with an [agents.<name>] table
+type Agent struct {
+	// Command is a text/template rendered with .Path, .Branch, .Prompt and .PromptFile, each shell-quoted.
+	// With the arg and file methods the prompt or its file is appended if the template doesn't use it.
+	Command string `toml:"command"`
+	// Prompt is how the prompt reaches the agent: send-keys, arg, stdin or file
+	Prompt string `toml:"prompt"`
+	// Commands each open an additional window, unless windows are given with --command
+	Commands []string `toml:"commands"`
+	// Ready are regular expressions matching the agent's output when it is waiting for input,
+	// so it is seen as idle without waiting for its output to settle
+	Ready []string `toml:"ready"`
+}
+
+// builtinAgents are available without any configuration. An [agents.<name>] table with the same name
+// only needs to set the fields it changes.
+var builtinAgents = map[string]Agent{
+	"opencode": {Command: "opencode {{.Path}}", Prompt: PromptSendKeys},
+	"claude":   {Command: "claude", Prompt: PromptArg, Ready: []string{`\? for shortcuts`}},
+	"codex":    {Command: "codex", Prompt: PromptArg},
+	"aider":    {Command: "aider", Prompt: PromptSendKeys, Ready: []string{`(?m)^> *$`}},
+}
+
+// ResolveAgent returns the name and profile of the selected agent. A --bin launches that binary as-is,
+// with the prompt typed in, instead of an agent profile.
+func (c *Config) ResolveAgent() (string, Agent, error) {
+	if c.Bin != "" {
+		return c.Bin, Agent{Command: c.Bin, Prompt: PromptSendKeys}, nil
+	}
+
+	agent, err := c.AgentProfile(c.Agent)
+	if err != nil {
+		return "", Agent{}, err
+	}
+	return c.Agent, agent, nil
+}
+
+// AgentProfile returns the named agent profile, with any fields its [agents.<name>] table leaves unset taken
+// from the built-in profile of the same name
+func (c *Config) AgentProfile(name string) (Agent, error) {
+	agent, configured := c.Agents[name]
+	builtin, known := builtinAgents[name]
+	if !configured && !known {
+		return Agent{}, fmt.Errorf("unknown agent '%s', add an [agents.%s] table to config.toml", name, name)
+	}
+
+	if agent.Command == "" {
+		agent.Command = builtin.Command
+	}
+	if agent.Prompt == "" {
+		agent.Prompt = builtin.Prompt
+	}
+	if agent.Prompt == "" {
+		agent.Prompt = PromptSendKeys
+	}
+	if agent.Commands == nil {
+		agent.Commands = builtin.Commands
+	}
+	if agent.Ready == nil {
+		agent.Ready = builtin.Ready
+	}
+
+	if agent.Command == "" {
+		return Agent{}, fmt.Errorf("agent '%s' has no command", name)
+	}
+	if err := ValidatePromptMethod(agent.Prompt); err != nil {
+		return Agent{}, fmt.Errorf("agent '%s': %w", name, err)
+	}
+
+	return agent, nil
+}
+
+func ValidatePromptMethod(method string) error {
+	if !slices.Contains(promptMethods, method) {
+		return fmt.Errorf("unknown prompt delivery '%s', expected send-keys, arg, stdin or file", method)
+	}
+	return nil
+}
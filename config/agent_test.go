@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestResolveAgent(t *testing.T) {
+	cfg := New()
+	cfg.Agents["claude"] = Agent{Commands: []string{"lazygit"}}
+	cfg.Agents["mine"] = Agent{Command: "mine {{.Path}}", Prompt: PromptFile}
+
+	cfg.Agent = "claude"
+	name, agent, err := cfg.ResolveAgent()
+	if err != nil || name != "claude" || agent.Command != "claude" || agent.Prompt != PromptArg || len(agent.Commands) != 1 {
+		t.Errorf("ResolveAgent() for an overridden builtin = %q, %+v, %v", name, agent, err)
+	}
+
+	cfg.Agent = "mine"
+	if _, agent, err = cfg.ResolveAgent(); err != nil || agent.Prompt != PromptFile {
+		t.Errorf("ResolveAgent() for a configured agent = %+v, %v", agent, err)
+	}
+
+	cfg.Agent = "missing"
+	if _, _, err = cfg.ResolveAgent(); err == nil {
+		t.Error("ResolveAgent() for an unknown agent should fail")
+	}
+
+	cfg.Bin = "my-agent --fast"
+	if name, agent, err = cfg.ResolveAgent(); err != nil || name != "my-agent --fast" || agent.Prompt != PromptSendKeys {
+		t.Errorf("ResolveAgent() with --bin = %q, %+v, %v", name, agent, err)
+	}
+
+	cfg.Bin = "opencode"
+	if name, agent, err = cfg.ResolveAgent(); err != nil || name != "opencode" || agent.Command != "opencode" {
+		t.Errorf("ResolveAgent() with --bin opencode = %q, %+v, %v, want the binary rather than the profile", name, agent, err)
+	}
+}
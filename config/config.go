@@ -5,33 +5,117 @@ import (
 	"github.com/BurntSushi/toml"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Config struct {
-	Bin       string
-	Commands  []string
-	Copy      []string
-	Data      string
-	Debug     bool
-	Silent    bool
-	Gitignore bool
-	Window    bool
+	// Bin is a binary launched as-is in new trees instead of an agent profile, when set
+	Bin         string
+	Commands    []string
+	Copy        []string
+	Data        string
+	Debug       bool
+	Silent      bool
+	Gitignore   bool
+	Window      bool
+	Strategy    string `toml:"strategy"`
+	Multiplexer string `toml:"multiplexer"`
+	Headless    bool   `toml:"headless"`
+	// Agent is the name of the agent profile to launch in new trees
+	Agent  string           `toml:"agent"`
+	Agents map[string]Agent `toml:"agents"`
+	// PromptVia overrides the selected agent's prompt delivery method
+	PromptVia string `toml:"prompt_via"`
+	// Templates are named text/template prompts selected with --template
+	Templates map[string]string `toml:"templates"`
+	// IdleAfter is how long an agent's output must stay unchanged before it is considered idle
+	IdleAfter time.Duration `toml:"idle_after"`
+	// Notify lists the notifiers used when an agent goes idle or stops
+	Notify []string `toml:"notify"`
+	// NotifyCommand is run through the shell by the command notifier
+	NotifyCommand string `toml:"notify_command"`
+	// NotifyIdle watches new trees in the background, notifying once their agent goes idle or stops
+	NotifyIdle bool     `toml:"notify_idle"`
+	Hooks      Hooks    `toml:"hooks"`
+	AutoCopy   AutoCopy `toml:"auto_copy"`
+	// From is the ref new trees branch from, instead of the root's HEAD
+	From string `toml:"from"`
+	// Base is the branch new trees are merged back into, when it can't be worked out from From
+	Base string `toml:"base"`
+	// CheckoutExisting opens new trees on an existing local or remote branch instead of creating one
+	CheckoutExisting bool `toml:"checkout_existing"`
+	// Share lists paths in the git root, like node_modules, that every tree links to or is seeded from
+	Share []string `toml:"share"`
+}
+
+// AutoCopy brings the files git ignores in the git root, like .env files, into new trees without
+// listing each with --copy. Configured in an [auto_copy] table.
+type AutoCopy struct {
+	Enabled bool `toml:"enabled"`
+	// Include limits the files copied to those matching one of these globs
+	Include []string `toml:"include"`
+	// Exclude skips files matching any of these globs
+	Exclude []string `toml:"exclude"`
+	// Mode is how the files are brought into the tree: copy, symlink, hardlink or reflink
+	Mode string `toml:"mode"`
+}
+
+// Hooks are shell commands run at points in a tree's life, configured in a [hooks] table. Failing pre-hooks
+// abort what they run before.
+type Hooks struct {
+	// PreCreate runs in the git root before the worktree is added
+	PreCreate []string `toml:"pre_create"`
+	// PostCreate runs in the new worktree before its agent is started
+	PostCreate []string `toml:"post_create"`
+	// PreMerge runs in the worktree before it is merged
+	PreMerge []string `toml:"pre_merge"`
+	// PostMerge runs in the git root once the tree is merged and removed
+	PostMerge []string `toml:"post_merge"`
+	// PreDiscard runs in the worktree before it is discarded
+	PreDiscard []string `toml:"pre_discard"`
 }
 
 func New() *Config {
 	return &Config{
-		Bin:       "opencode",
-		Commands:  []string{},
-		Copy:      []string{},
-		Data:      os.ExpandEnv("$HOME/.local/share/treeai"),
-		Debug:     false,
-		Silent:    false,
-		Gitignore: false,
-		Window:    false,
+		Commands:    []string{},
+		Copy:        []string{},
+		Data:        os.ExpandEnv("$HOME/.local/share/treeai"),
+		Debug:       false,
+		Silent:      false,
+		Gitignore:   false,
+		Window:      false,
+		Strategy:    "rebase-ff",
+		Multiplexer: "tmux",
+		Headless:    false,
+		Agent:       "opencode",
+		Agents:      map[string]Agent{},
+		IdleAfter:   10 * time.Second,
+		Notify:      []string{NotifyMessage},
+		AutoCopy:    AutoCopy{Mode: "copy"},
 	}
 }
 
-func (c *Config) WorktreePath(worktreeName string) string {
+// RepoDir is the directory holding every worktree for the repository identified by repoID
+func (c *Config) RepoDir(repoID string) string {
+	return filepath.Join(c.Data, repoID)
+}
+
+func (c *Config) WorktreePath(repoID, worktreeName string) string {
+	return filepath.Join(c.RepoDir(repoID), worktreeName)
+}
+
+// LogPath is where the output of a headless agent is written
+func (c *Config) LogPath(repoID, worktreeName string) string {
+	return filepath.Join(c.Data, "logs", repoID, worktreeName+".log")
+}
+
+// PromptPath is where the prompt is written for agents that read it from a file or stdin
+func (c *Config) PromptPath(repoID, worktreeName string) string {
+	return filepath.Join(c.Data, "prompts", repoID, worktreeName+".md")
+}
+
+// LegacyWorktreePath is where worktrees lived before the data directory was namespaced per repository
+func (c *Config) LegacyWorktreePath(worktreeName string) string {
 	return filepath.Join(c.Data, worktreeName)
 }
 
@@ -52,31 +136,83 @@ func (c *Config) ToSlogAttrs() []any {
 	return attrs
 }
 
-func (c *Config) ApplyFlags(bin string, silent bool, data string, windowCommands, copy []string, useGitignore, debug, window bool) {
-	// only override if flag was explicitly set (you'll need to track this in cobra)
-	if bin != "opencode" {
-		c.Bin = bin
+// Flags are the command line flags that override config.toml. Flags left at their zero value keep the
+// configured setting.
+type Flags struct {
+	Bin              string
+	Silent           bool
+	Data             string
+	Commands         []string
+	Copy             []string
+	Gitignore        bool
+	Debug            bool
+	Window           bool
+	Strategy         string
+	Multiplexer      string
+	Headless         bool
+	Agent            string
+	PromptVia        string
+	NotifyIdle       bool
+	AutoCopy         bool
+	From             string
+	Base             string
+	CheckoutExisting bool
+}
+
+func (c *Config) ApplyFlags(f Flags) {
+	if f.Bin != "" {
+		c.Bin = f.Bin
+	}
+	if f.Silent {
+		c.Silent = f.Silent
+	}
+	if f.Gitignore {
+		c.Gitignore = f.Gitignore
+	}
+	if len(f.Commands) > 0 {
+		c.Commands = f.Commands
+	}
+	if f.Debug {
+		c.Debug = f.Debug
+	}
+	if f.Window {
+		c.Window = f.Window
+	}
+	if f.Data != "" {
+		c.Data = f.Data
+	}
+	if len(f.Copy) > 0 {
+		c.Copy = f.Copy
+	}
+	if f.Strategy != "" {
+		c.Strategy = f.Strategy
+	}
+	if f.Multiplexer != "" {
+		c.Multiplexer = f.Multiplexer
+	}
+	if f.Headless {
+		c.Headless = f.Headless
 	}
-	if silent {
-		c.Silent = silent
+	if f.Agent != "" {
+		c.Agent = f.Agent
 	}
-	if useGitignore {
-		c.Gitignore = useGitignore
+	if f.PromptVia != "" {
+		c.PromptVia = f.PromptVia
 	}
-	if len(windowCommands) > 0 {
-		c.Commands = windowCommands
+	if f.NotifyIdle {
+		c.NotifyIdle = f.NotifyIdle
 	}
-	if debug {
-		c.Debug = debug
+	if f.AutoCopy {
+		c.AutoCopy.Enabled = f.AutoCopy
 	}
-	if window {
-		c.Window = window
+	if f.From != "" {
+		c.From = f.From
 	}
-	if data != "" {
-		c.Data = data
+	if f.Base != "" {
+		c.Base = f.Base
 	}
-	if len(copy) > 0 {
-		c.Copy = copy
+	if f.CheckoutExisting {
+		c.CheckoutExisting = f.CheckoutExisting
 	}
 }
 
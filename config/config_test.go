@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	if err := os.MkdirAll(filepath.Join(dir, "treeai"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "prompt_via = \"file\"\ncheckout_existing = true\nidle_after = \"3s\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "treeai", "config.toml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if cfg.PromptVia != PromptFile || !cfg.CheckoutExisting || cfg.IdleAfter.String() != "3s" {
+		t.Errorf("Load() = prompt_via %q, checkout_existing %v, idle_after %v, want the snake_case keys read", cfg.PromptVia, cfg.CheckoutExisting, cfg.IdleAfter)
+	}
+	if cfg.Strategy != "rebase-ff" {
+		t.Errorf("Load() strategy = %q, want the default kept", cfg.Strategy)
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	cfg := New()
+	cfg.Strategy = "squash"
+	cfg.ApplyFlags(Flags{Bin: "my-agent", Base: "develop", CheckoutExisting: true})
+
+	if cfg.Bin != "my-agent" || cfg.Base != "develop" || !cfg.CheckoutExisting {
+		t.Errorf("ApplyFlags() = bin %q, base %q, checkout existing %v, want the flags applied", cfg.Bin, cfg.Base, cfg.CheckoutExisting)
+	}
+	if cfg.Strategy != "squash" || cfg.Agent != "opencode" {
+		t.Errorf("ApplyFlags() = strategy %q, agent %q, want unset flags to keep the config", cfg.Strategy, cfg.Agent)
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Notifiers, which tell the user when a tree's agent has finished or needs input
+const (
+	// NotifyMessage shows a message in the multiplexer session the tree was created from
+	NotifyMessage = "message"
+	// NotifyBell rings the terminal bell
+	NotifyBell = "bell"
+	// NotifyDesktop sends a desktop notification with notify-send
+	NotifyDesktop = "notify-send"
+	// NotifyCommand runs notify_command, with the tree and its state in TREEAI_* environment variables
+	NotifyCommand = "command"
+)
+
+var notifiers = []string{NotifyMessage, NotifyBell, NotifyDesktop, NotifyCommand}
+
+// ValidateNotifiers checks the configured notifiers are known and have what they need
+func (c *Config) ValidateNotifiers() error {
+	for _, notifier := range c.Notify {
+		if !slices.Contains(notifiers, notifier) {
+			return fmt.Errorf("unknown notifier '%s', expected message, bell, notify-send or command", notifier)
+		}
+		if notifier == NotifyCommand && c.NotifyCommand == "" {
+			return fmt.Errorf("the command notifier needs notify_command to be set in config.toml")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import "testing"
+
+func TestValidateNotifiers(t *testing.T) {
+	cfg := New()
+	if err := cfg.ValidateNotifiers(); err != nil {
+		t.Errorf("ValidateNotifiers() with the defaults = %v", err)
+	}
+
+	cfg.Notify = []string{NotifyBell, NotifyCommand}
+	if err := cfg.ValidateNotifiers(); err == nil {
+		t.Error("ValidateNotifiers() for the command notifier without notify_command should fail")
+	}
+
+	cfg.NotifyCommand = "say done"
+	if err := cfg.ValidateNotifiers(); err != nil {
+		t.Errorf("ValidateNotifiers() with notify_command = %v", err)
+	}
+
+	cfg.Notify = []string{"carrier-pigeon"}
+	if err := cfg.ValidateNotifiers(); err == nil {
+		t.Error("ValidateNotifiers() for an unknown notifier should fail")
+	}
+}
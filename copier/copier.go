@@ -0,0 +1,262 @@
+package copier
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// Mode is how a copy entry is brought into a tree
+type Mode string
+
+const (
+	// ModeCopy copies files, keeping their permissions
+	ModeCopy Mode = "copy"
+	// ModeSymlink links the entry back to the git root, so the root and the tree share it
+	ModeSymlink Mode = "symlink"
+	// ModeHardlink hard links files, sharing their contents until one side replaces them
+	ModeHardlink Mode = "hardlink"
+	// ModeReflink clones files copy-on-write where the filesystem supports it, and copies them otherwise
+	ModeReflink Mode = "reflink"
+)
+
+var modes = []Mode{ModeCopy, ModeSymlink, ModeHardlink, ModeReflink}
+
+// Entry is a path or glob relative to the git root, and how the paths it matches are brought into a tree
+type Entry struct {
+	Pattern string
+	Mode    Mode
+}
+
+// ParseEntry parses a path[:mode] copy entry. Without a mode the matches are copied. The text after the last ':'
+// is only taken as the mode when it names one, so paths containing ':' can be copied as they are.
+func ParseEntry(s string) (Entry, error) {
+	entry := Entry{Pattern: s, Mode: ModeCopy}
+	if i := strings.LastIndex(s, ":"); i >= 0 && slices.Contains(modes, Mode(s[i+1:])) {
+		entry = Entry{Pattern: s[:i], Mode: Mode(s[i+1:])}
+	}
+
+	if entry.Pattern == "" {
+		return Entry{}, fmt.Errorf("copy entry '%s' has no path", s)
+	}
+	if clean := filepath.Clean(entry.Pattern); filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return Entry{}, fmt.Errorf("copy entry '%s' must be inside the git root", s)
+	}
+	if _, err := filepath.Match(entry.Pattern, ""); err != nil {
+		return Entry{}, fmt.Errorf("invalid copy pattern '%s': %w", entry.Pattern, err)
+	}
+	return entry, nil
+}
+
+func ParseMode(s string) (Mode, error) {
+	if !slices.Contains(modes, Mode(s)) {
+		return "", fmt.Errorf("unknown copy mode '%s', expected copy, symlink, hardlink or reflink", s)
+	}
+	return Mode(s), nil
+}
+
+// Share modes, for entries of the share list
+const (
+	// ShareLink symlinks the entry back to the git root, so every tree uses the root's copy
+	ShareLink = "symlink"
+	// ShareSeed hard links the entry's files once, so each tree starts from the root's copy but can diverge
+	ShareSeed = "seed"
+)
+
+// ParseShare parses a path[:symlink|seed] share entry. Without a mode the entry is symlinked.
+func ParseShare(s string) (Entry, error) {
+	pattern, share := s, ShareLink
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		pattern, share = s[:i], s[i+1:]
+	}
+
+	var mode Mode
+	switch share {
+	case ShareLink:
+		mode = ModeSymlink
+	case ShareSeed:
+		mode = ModeHardlink
+	default:
+		return Entry{}, fmt.Errorf("unknown share mode '%s' in '%s', expected symlink or seed", share, s)
+	}
+
+	entry, err := ParseEntry(pattern)
+	if err != nil {
+		return Entry{}, err
+	}
+	entry.Mode = mode
+	return entry, nil
+}
+
+func ParseEntries(entries []string) ([]Entry, error) {
+	parsed := make([]Entry, 0, len(entries))
+	for _, s := range entries {
+		entry, err := ParseEntry(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, entry)
+	}
+	return parsed, nil
+}
+
+// Result is what Apply brought into a tree, relative to the roots, and the patterns that matched nothing
+type Result struct {
+	Paths []string
+	// Links are the paths that were symlinked back to the source
+	Links   []string
+	Missing []string
+}
+
+// Apply brings every path matching the entries under srcRoot to the same place under dstRoot
+func Apply(srcRoot, dstRoot string, entries []Entry) (*Result, error) {
+	result := &Result{}
+	for _, entry := range entries {
+		matches, err := filepath.Glob(filepath.Join(srcRoot, entry.Pattern))
+		if err != nil {
+			return result, fmt.Errorf("invalid copy pattern '%s': %w", entry.Pattern, err)
+		}
+		if len(matches) == 0 {
+			result.Missing = append(result.Missing, entry.Pattern)
+			continue
+		}
+
+		for _, match := range matches {
+			rel, err := filepath.Rel(srcRoot, match)
+			if err != nil {
+				return result, err
+			}
+			if err = Place(match, filepath.Join(dstRoot, rel), entry.Mode); err != nil {
+				return result, err
+			}
+			result.Paths = append(result.Paths, rel)
+			if entry.Mode == ModeSymlink {
+				result.Links = append(result.Links, rel)
+			}
+		}
+	}
+	return result, nil
+}
+
+// Place brings a single file or directory to dst. Directories are symlinked as a whole, and otherwise
+// recreated with every file in them brought over with the mode.
+func Place(src, dst string, mode Mode) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", src, err)
+	}
+
+	if mode == ModeSymlink {
+		return link(src, dst, os.Symlink)
+	}
+	if !info.IsDir() {
+		return placeFile(src, dst, info, mode)
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			if err = os.MkdirAll(target, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("error creating directory: %w", err)
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		}
+		return placeFile(path, target, info, mode)
+	})
+}
+
+func placeFile(src, dst string, info fs.FileInfo, mode Mode) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return fmt.Errorf("error reading link %s: %w", src, err)
+		}
+		return link(target, dst, os.Symlink)
+	}
+	if !info.Mode().IsRegular() {
+		return nil // sockets, pipes and devices can't be brought along
+	}
+
+	switch mode {
+	case ModeHardlink:
+		// files can't be hard linked across filesystems, so they are copied instead
+		if err := link(src, dst, os.Link); !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+	case ModeReflink:
+		if err := reflink(src, dst, info.Mode().Perm()); err == nil {
+			return nil
+		}
+	}
+	return CopyFile(src, dst, info.Mode().Perm())
+}
+
+// link replaces any file at dst with a link to src
+func link(src, dst string, makeLink func(string, string) error) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("error creating directory: %w", err)
+	}
+
+	if info, err := os.Lstat(dst); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("cannot link %s: a directory is already there", dst)
+		}
+		if err = os.Remove(dst); err != nil {
+			return fmt.Errorf("error replacing %s: %w", dst, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := makeLink(src, dst); err != nil {
+		return fmt.Errorf("error linking %s: %w", dst, err)
+	}
+	return nil
+}
+
+// CopyFile copies a file's contents, giving the copy the permissions perm
+func CopyFile(srcPath, dstPath string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("error opening source file: %v", err)
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("error creating destination file: %v", err)
+	}
+	defer dstFile.Close()
+
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		return fmt.Errorf("error copying file: %v", err)
+	}
+	// the umask, or an existing file, may have left different permissions
+	return dstFile.Chmod(perm)
+}
@@ -0,0 +1,161 @@
+package copier
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Entry
+		wantErr bool
+	}{
+		{".env", Entry{".env", ModeCopy}, false},
+		{"node_modules:symlink", Entry{"node_modules", ModeSymlink}, false},
+		{"config/*.local.yaml:hardlink", Entry{"config/*.local.yaml", ModeHardlink}, false},
+		{"data:reflink", Entry{"data", ModeReflink}, false},
+		{"data:move", Entry{"data:move", ModeCopy}, false},
+		{"logs/12:00:00.txt", Entry{"logs/12:00:00.txt", ModeCopy}, false},
+		{"logs/12:00:symlink", Entry{"logs/12:00", ModeSymlink}, false},
+		{":copy", Entry{}, true},
+		{"../outside", Entry{}, true},
+		{"/etc/passwd", Entry{}, true},
+		{"[bad", Entry{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseEntry(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseEntry(%q) = %+v, %v, want %+v, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	write := func(path string, perm os.FileMode) {
+		t.Helper()
+		full := filepath.Join(src, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(path), perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".env", 0600)
+	write(".env.local", 0644)
+	write("tools/run.sh", 0755)
+	write("tools/lib/helper", 0644)
+	write("cache/blob", 0644)
+	write("shared.db", 0644)
+
+	entries, err := ParseEntries([]string{".env*", "tools", "cache:symlink", "shared.db:hardlink", "missing/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Apply(src, dst, entries)
+	if err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+
+	wantPaths := []string{".env", ".env.local", "tools", "cache", "shared.db"}
+	if !slices.Equal(result.Paths, wantPaths) {
+		t.Errorf("Apply() paths = %v, want %v", result.Paths, wantPaths)
+	}
+	if !slices.Equal(result.Missing, []string{"missing/*"}) {
+		t.Errorf("Apply() missing = %v, want [missing/*]", result.Missing)
+	}
+
+	for path, perm := range map[string]os.FileMode{".env": 0600, "tools/run.sh": 0755, "tools/lib/helper": 0644} {
+		info, err := os.Stat(filepath.Join(dst, path))
+		if err != nil {
+			t.Errorf("%s was not copied: %v", path, err)
+			continue
+		}
+		if info.Mode().Perm() != perm {
+			t.Errorf("%s has mode %v, want %v", path, info.Mode().Perm(), perm)
+		}
+	}
+
+	if target, err := os.Readlink(filepath.Join(dst, "cache")); err != nil || target != filepath.Join(src, "cache") {
+		t.Errorf("cache links to %q, %v, want the source directory", target, err)
+	}
+
+	srcInfo, _ := os.Stat(filepath.Join(src, "shared.db"))
+	dstInfo, err := os.Stat(filepath.Join(dst, "shared.db"))
+	if err != nil || !os.SameFile(srcInfo, dstInfo) {
+		t.Errorf("shared.db is not a hard link to the source: %v", err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	paths := []string{".env", "config/app.local.yaml", "debug.log", "node_modules/", "web/node_modules/", "secrets/key", "notes.txt"}
+	explicit := []Entry{{Pattern: "secrets", Mode: ModeSymlink}}
+
+	got := Select(paths, []string{".env*", "*.local.yaml", "*.log", "secrets"}, []string{"debug.log"}, explicit)
+	want := []Candidate{
+		{Path: ".env"},
+		{Path: "config/app.local.yaml"},
+		{Path: "debug.log", Skip: SkipExcluded},
+		{Path: "node_modules", Skip: SkipHeavy},
+		{Path: "web/node_modules", Skip: SkipHeavy},
+		{Path: "secrets/key", Skip: SkipExplicit},
+		{Path: "notes.txt", Skip: SkipNotIncluded},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Select() = %+v, want %+v", got, want)
+	}
+
+	if got := Select([]string{"notes.txt"}, nil, nil, nil); len(got) != 1 || got[0].Skip != "" {
+		t.Errorf("Select() without include patterns = %+v, want everything", got)
+	}
+}
+
+func TestExpandDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{"cache/a", "cache/sub/b", "cache/node_modules/c", "node_modules/d"} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ExpandDirs(root, []string{".env", "cache/", "node_modules/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".env", "cache/a", "cache/node_modules/", "cache/sub/b", "node_modules/"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExpandDirs() = %v, want %v", got, want)
+	}
+}
+
+func TestParseShare(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Entry
+		wantErr bool
+	}{
+		{"node_modules", Entry{"node_modules", ModeSymlink}, false},
+		{".venv:symlink", Entry{".venv", ModeSymlink}, false},
+		{"target:seed", Entry{"target", ModeHardlink}, false},
+		{"target:copy", Entry{}, true},
+		{"../elsewhere:seed", Entry{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseShare(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseShare(%q) = %+v, %v, want %+v, error %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package copier
+
+import (
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// HeavyDirs are never copied into trees automatically, being large and cheap to rebuild
+var HeavyDirs = []string{
+	"node_modules", ".venv", "venv", "__pycache__", ".direnv", ".terraform", ".next", ".nuxt",
+	".cache", ".gradle", ".tox", "dist", "build", "target",
+}
+
+// Skip reasons for discovered paths that aren't copied
+const (
+	SkipHeavy       = "heavy directory"
+	SkipExcluded    = "excluded"
+	SkipNotIncluded = "not included"
+	SkipExplicit    = "given with --copy or share"
+)
+
+// Candidate is a discovered path and, if it won't be copied, why not
+type Candidate struct {
+	Path string
+	Skip string
+}
+
+// Select decides which discovered paths to copy. A path is copied when it matches an include pattern, or
+// there are none, and matches no exclude pattern, no explicit entry and has no heavy directory in it.
+// Patterns without a slash match any part of the path, like in .gitignore.
+func Select(paths, include, exclude []string, explicit []Entry) []Candidate {
+	candidates := make([]Candidate, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSuffix(path, "/")
+		candidate := Candidate{Path: path}
+
+		switch {
+		case isHeavy(path):
+			candidate.Skip = SkipHeavy
+		case slices.ContainsFunc(explicit, func(e Entry) bool { return matchPattern(e.Pattern, path) }):
+			candidate.Skip = SkipExplicit
+		case slices.ContainsFunc(exclude, func(p string) bool { return matchPattern(p, path) }):
+			candidate.Skip = SkipExcluded
+		case len(include) > 0 && !slices.ContainsFunc(include, func(p string) bool { return matchPattern(p, path) }):
+			candidate.Skip = SkipNotIncluded
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// ExpandDirs replaces the directories in paths, marked with a trailing slash as git lists them, with the
+// files inside them, so patterns can be applied file by file. Heavy directories are kept whole, not walked.
+func ExpandDirs(root string, paths []string) ([]string, error) {
+	var expanded []string
+	for _, path := range paths {
+		if !strings.HasSuffix(path, "/") || isHeavy(path) {
+			expanded = append(expanded, path)
+			continue
+		}
+
+		err := filepath.WalkDir(filepath.Join(root, path), func(full string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, full)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			switch {
+			case d.IsDir() && slices.Contains(HeavyDirs, d.Name()):
+				expanded = append(expanded, rel+"/")
+				return filepath.SkipDir
+			case !d.IsDir():
+				expanded = append(expanded, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expanded, nil
+}
+
+func isHeavy(path string) bool {
+	return slices.ContainsFunc(strings.Split(strings.TrimSuffix(path, "/"), "/"), func(part string) bool {
+		return slices.Contains(HeavyDirs, part)
+	})
+}
+
+// matchPattern matches a path, or any directory it is in, against a glob
+func matchPattern(pattern, path string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	parts := strings.Split(path, "/")
+	for i := range parts {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := filepath.Match(pattern, parts[i]); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, strings.Join(parts[:i+1], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Literal is an entry for exactly path, with any glob characters in it escaped
+func Literal(path string, mode Mode) Entry {
+	var escaped strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return Entry{Pattern: escaped.String(), Mode: mode}
+}
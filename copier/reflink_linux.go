@@ -0,0 +1,37 @@
+//go:build linux
+
+package copier
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which shares a file's extents copy-on-write on btrfs, XFS and similar filesystems
+const ficlone = 0x40049409
+
+func reflink(src, dst string, perm fs.FileMode) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dstFile.Fd(), ficlone, srcFile.Fd()); errno != 0 {
+		dstFile.Close()
+		os.Remove(dst)
+		return errno
+	}
+
+	if err = dstFile.Chmod(perm); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
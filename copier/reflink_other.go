@@ -0,0 +1,12 @@
+//go:build !linux
+
+package copier
+
+import (
+	"errors"
+	"io/fs"
+)
+
+func reflink(src, dst string, perm fs.FileMode) error {
+	return errors.ErrUnsupported
+}
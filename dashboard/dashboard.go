@@ -0,0 +1,332 @@
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/treeai"
+)
+
+// Header is the column headings of Row
+var Header = []string{"NAME", "BRANCH", "COMMITS", "LAST COMMIT", "DIRTY", "AGENT", "SESSION"}
+
+// Row is the columns describing a tree in the status table
+func Row(s treeai.WorktreeStatus, now time.Time) []string {
+	dirty := "no"
+	if s.Dirty {
+		dirty = "yes"
+	}
+	if s.Err != nil {
+		dirty = "?"
+	}
+
+	lastCommit := "-"
+	if !s.LastCommit.IsZero() {
+		lastCommit = FormatAge(now.Sub(s.LastCommit)) + " ago"
+	}
+
+	session := "-"
+	if s.Alive && !s.Headless {
+		session = s.Session
+	}
+
+	return []string{s.Name, s.Branch, fmt.Sprint(s.Ahead), lastCommit, dirty, s.AgentState(), session}
+}
+
+// FormatAge formats a duration in the largest whole unit, like 45s, 12m, 3h or 2d
+func FormatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// action is a key press waiting to be confirmed
+type action struct {
+	verb string
+	name string
+}
+
+type dashboard struct {
+	cfg       *config.Config
+	term      *terminal
+	statuses  []treeai.WorktreeStatus
+	refreshed time.Time
+	selected  int
+	message   string
+	pending   *action
+	// notify tells the user when an agent stops working, tracking the state each tree's agent was last seen in
+	notify bool
+	states map[string]string
+}
+
+// Run shows a full screen table of the repository's trees, refreshed every interval, until q is pressed.
+// With notify, the configured notifiers are used whenever an agent goes from working to idle or stops.
+func Run(cfg *config.Config, interval time.Duration, notify bool) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.suspend()
+
+	d := &dashboard{cfg: cfg, term: term, notify: notify, states: map[string]string{}}
+	buf := make([]byte, 16)
+	for {
+		if time.Since(d.refreshed) >= interval {
+			d.refresh()
+			d.render()
+		}
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			continue
+		}
+
+		if quit := d.handleKey(string(buf[:n])); quit {
+			return nil
+		}
+		d.render()
+	}
+}
+
+func (d *dashboard) refresh() {
+	statuses, err := treeai.ListWorktrees(d.cfg)
+	if err != nil {
+		d.message = fmt.Sprintf("Error: %v", err)
+	} else {
+		d.statuses = statuses
+		d.notifyChanges()
+	}
+	d.refreshed = time.Now()
+
+	if d.selected >= len(d.statuses) {
+		d.selected = max(len(d.statuses)-1, 0)
+	}
+}
+
+// notifyChanges notifies about agents that were working at the last refresh and no longer are
+func (d *dashboard) notifyChanges() {
+	for _, s := range d.statuses {
+		state := s.AgentState()
+		previous, seen := d.states[s.Path]
+		d.states[s.Path] = state
+		if !d.notify || !seen || !working(previous) || working(state) {
+			continue
+		}
+		if err := treeai.Notify(d.cfg, s.Path, state); err != nil {
+			d.message = fmt.Sprintf("Error: %v", err)
+		}
+	}
+}
+
+// working is whether an agent state means it is still busy. Agents whose output can't be read are
+// only known to be running.
+func working(state string) bool {
+	return state == treeai.ActivityWorking || state == "running"
+}
+
+// handleKey acts on a key press, returning true to quit
+func (d *dashboard) handleKey(key string) bool {
+	if d.pending != nil {
+		pending := d.pending
+		d.pending = nil
+		d.message = ""
+		if key == "y" || key == "Y" {
+			d.runTreeai(pending.verb, pending.name)
+		}
+		return false
+	}
+
+	d.message = ""
+	switch key {
+	case "q", "\x03", "\x1b":
+		return true
+	case "j", "\x1b[B", "\x1bOB":
+		if d.selected < len(d.statuses)-1 {
+			d.selected++
+		}
+	case "k", "\x1b[A", "\x1bOA":
+		if d.selected > 0 {
+			d.selected--
+		}
+	case "r":
+		d.refresh()
+	}
+
+	if len(d.statuses) == 0 {
+		return false
+	}
+	s := d.statuses[d.selected]
+
+	switch key {
+	case "\r", "\n", "s":
+		d.switchTo(s)
+	case "m":
+		d.pending = &action{verb: "merge", name: s.Name}
+		d.message = fmt.Sprintf("Merge %s into %s? [y/N]", s.Name, s.Base)
+	case "d":
+		d.pending = &action{verb: "discard", name: s.Name}
+		d.message = fmt.Sprintf("Discard %s and delete branch %s? [y/N]", s.Name, s.Branch)
+		if s.ExistingBranch {
+			d.message = fmt.Sprintf("Discard %s, keeping branch %s? [y/N]", s.Name, s.Branch)
+		}
+	case "v":
+		d.showDiff(s)
+	}
+	return false
+}
+
+// switchTo focuses a tree's session, or pages through its log if it runs headless
+func (d *dashboard) switchTo(s treeai.WorktreeStatus) {
+	if s.Headless {
+		pager := os.Getenv("PAGER")
+		if pager == "" {
+			pager = "less +G"
+		}
+		d.runInTerminal(exec.Command("sh", "-c", pager+` "$1"`, pager, s.Log), false)
+		return
+	}
+
+	d.term.suspend()
+	err := treeai.SwitchToWorktree(d.cfg, s.Name)
+	d.term.resume()
+	if err != nil {
+		d.message = fmt.Sprintf("Error: %v", err)
+	}
+}
+
+// showDiff pages through everything the tree changed since it diverged from its base, including uncommitted
+// changes. The diff is read through the git package first, so only the pager runs in the terminal.
+func (d *dashboard) showDiff(s treeai.WorktreeStatus) {
+	mergeBase, err := git.MergeBase(s.Path, s.Base, "HEAD")
+	if err != nil {
+		d.message = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	diff, err := git.DiffWorktree(s.Path, mergeBase, true)
+	if err != nil {
+		d.message = fmt.Sprintf("Error: %v", err)
+		return
+	}
+
+	pager := os.Getenv("GIT_PAGER")
+	if pager == "" {
+		pager = os.Getenv("PAGER")
+	}
+	if pager == "" {
+		pager = "less -R"
+	}
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = strings.NewReader(diff)
+	d.runInTerminal(cmd, false)
+}
+
+// runTreeai runs a treeai subcommand on a tree, so that its prompts and exits don't end the dashboard
+func (d *dashboard) runTreeai(verb, name string) {
+	exe, err := os.Executable()
+	if err != nil {
+		d.message = fmt.Sprintf("Error: %v", err)
+		return
+	}
+
+	cmd := exec.Command(exe, verb, name, "--data", d.cfg.Data)
+	if d.cfg.Silent {
+		cmd.Args = append(cmd.Args, "--silent")
+	}
+	d.runInTerminal(cmd, true)
+	d.refresh()
+}
+
+// runInTerminal hands the terminal to cmd, optionally waiting for enter afterwards so its output can be read.
+// cmd reads from the terminal unless it was given its own stdin.
+func (d *dashboard) runInTerminal(cmd *exec.Cmd, wait bool) {
+	d.term.suspend()
+	defer d.term.resume()
+
+	if cmd.Stdin == nil {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		d.message = fmt.Sprintf("%s failed: %v", strings.Join(cmd.Args[:2], " "), err)
+	}
+
+	if wait {
+		fmt.Print("\nPress enter to return to the dashboard")
+		fmt.Scanln()
+	}
+}
+
+func (d *dashboard) render() {
+	rows, cols := d.term.size()
+
+	var table bytes.Buffer
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(Header, "\t"))
+	now := time.Now()
+	for _, s := range d.statuses {
+		fmt.Fprintln(w, strings.Join(Row(s, now), "\t"))
+	}
+	w.Flush()
+	lines := strings.Split(strings.TrimRight(table.String(), "\n"), "\n")
+
+	var out strings.Builder
+	out.WriteString(clearScreen)
+	fmt.Fprintf(&out, "%s%s%s\r\n\r\n", bold, truncate(fmt.Sprintf("treeai status  %d trees  refreshed %s", len(d.statuses), d.refreshed.Format("15:04:05")), cols), resetStyle)
+
+	// leave room for the title, footer and message
+	visible := max(rows-5, 1)
+	offset := 0
+	if d.selected >= visible {
+		offset = d.selected - visible + 1
+	}
+
+	fmt.Fprintf(&out, "%s  %s%s\r\n", bold, truncate(lines[0], cols-2), resetStyle)
+	if len(d.statuses) == 0 {
+		out.WriteString("  No worktrees found\r\n")
+	}
+	for i, line := range lines[1:] {
+		if i < offset || i >= offset+visible {
+			continue
+		}
+		if i == d.selected {
+			fmt.Fprintf(&out, "%s> %s%s\r\n", reverseVideo, truncate(line, cols-2), resetStyle)
+		} else {
+			fmt.Fprintf(&out, "  %s\r\n", truncate(line, cols-2))
+		}
+	}
+
+	fmt.Fprintf(&out, "\x1b[%d;1H%s\r\n", rows-1, truncate(d.message, cols))
+	out.WriteString(truncate("j/k select  enter switch  m merge  d discard  v diff  r refresh  q quit", cols))
+	fmt.Print(out.String())
+}
+
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width])
+}
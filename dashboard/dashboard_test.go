@@ -0,0 +1,25 @@
+package dashboard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatAge(t *testing.T) {
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{45 * time.Second, "45s"},
+		{12*time.Minute + 30*time.Second, "12m"},
+		{3 * time.Hour, "3h"},
+		{47 * time.Hour, "47h"},
+		{50 * time.Hour, "2d"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatAge(tt.age); got != tt.want {
+			t.Errorf("FormatAge(%v) = %q, want %q", tt.age, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package dashboard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	enterAltScreen = "\x1b[?1049h\x1b[?25l"
+	leaveAltScreen = "\x1b[?25h\x1b[?1049l"
+	clearScreen    = "\x1b[H\x1b[2J"
+	reverseVideo   = "\x1b[7m"
+	bold           = "\x1b[1m"
+	resetStyle     = "\x1b[0m"
+)
+
+// terminal puts the controlling terminal into raw mode with stty, since the standard library has no terminal support
+type terminal struct {
+	saved string
+}
+
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("status --watch needs an interactive terminal: %w", err)
+	}
+
+	t := &terminal{saved: strings.TrimSpace(saved)}
+	if err = t.resume(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// resume switches to the alternate screen in raw mode. Reads return after at most a tenth of a second,
+// so the dashboard can refresh while waiting for keys.
+func (t *terminal) resume() error {
+	if _, err := stty("raw", "-echo", "min", "0", "time", "1"); err != nil {
+		return fmt.Errorf("failed to put terminal in raw mode: %w", err)
+	}
+	fmt.Print(enterAltScreen)
+	return nil
+}
+
+// suspend restores the terminal as it was, so another program can use it
+func (t *terminal) suspend() {
+	fmt.Print(leaveAltScreen)
+	stty(t.saved)
+}
+
+// size returns the rows and columns of the terminal, falling back to 24x80
+func (t *terminal) size() (int, int) {
+	output, err := stty("size")
+	if err != nil {
+		return 24, 80
+	}
+
+	var rows, cols int
+	if _, err = fmt.Sscanf(output, "%d %d", &rows, &cols); err != nil || rows == 0 || cols == 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	output, err := cmd.Output()
+	return string(output), err
+}
@@ -0,0 +1,244 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ConflictError is returned when a rebase, merge or cherry-pick stops part way through because of conflicts
+type ConflictError struct {
+	Dir       string
+	Operation string
+	Files     []string
+	Output    string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s stopped with conflicts in %s: %s", e.Operation, e.Dir, strings.Join(e.Files, ", "))
+}
+
+// conflictError returns a *ConflictError if dir has unmerged paths after a failed operation, or nil otherwise
+func conflictError(dir, operation string, err error, output []byte) *ConflictError {
+	files, listErr := ConflictedFiles(dir)
+	if listErr != nil || len(files) == 0 {
+		return nil
+	}
+	return &ConflictError{Dir: dir, Operation: operation, Files: files, Output: string(output)}
+}
+
+// ConflictedFiles lists the unmerged paths in dir
+func ConflictedFiles(dir string) ([]string, error) {
+	output, err := stdout(dir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conflicted files: %w", err)
+	}
+
+	trimmed := strings.TrimSpace(string(output))
+	if trimmed == "" {
+		return nil, nil
+	}
+	return strings.Split(trimmed, "\n"), nil
+}
+
+func RebaseInProgress(dir string) bool {
+	return gitPathExists(dir, "rebase-merge") || gitPathExists(dir, "rebase-apply")
+}
+
+func MergeInProgress(dir string) bool {
+	return gitPathExists(dir, "MERGE_HEAD")
+}
+
+func CherryPickInProgress(dir string) bool {
+	return gitPathExists(dir, "CHERRY_PICK_HEAD") || gitPathExists(dir, "sequencer")
+}
+
+func gitPathExists(dir, name string) bool {
+	output, err := stdout(dir, "rev-parse", "--git-path", name)
+	if err != nil {
+		return false
+	}
+
+	path := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// MergeInto merges branchName into the current branch of dir, returning a *ConflictError if it stops on conflicts
+func MergeInto(dir, branchName string) error {
+	output, err := combined(dir, "merge", "--no-edit", branchName)
+	if err != nil {
+		if conflictErr := conflictError(dir, "merge", err, output); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to merge %s: %w\nOutput: %s", branchName, err, string(output))
+	}
+
+	return nil
+}
+
+// RebaseContinue continues a stopped rebase without opening an editor
+func RebaseContinue(dir string) error {
+	return continueOperation(dir, "rebase", "rebase", "--continue")
+}
+
+// CherryPickContinue continues a stopped cherry-pick without opening an editor
+func CherryPickContinue(dir string) error {
+	return continueOperation(dir, "cherry-pick", "cherry-pick", "--continue")
+}
+
+// CommitMerge concludes a stopped merge using the prepared merge message
+func CommitMerge(dir string) error {
+	return continueOperation(dir, "merge", "commit", "--no-edit")
+}
+
+func continueOperation(dir, operation string, args ...string) error {
+	res, err := run(Command{Args: args, Dir: dir, Env: []string{"GIT_EDITOR=true"}})
+	if err != nil {
+		output := []byte(res.Output())
+		if conflictErr := conflictError(dir, operation, err, output); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to continue %s: %w\nOutput: %s", operation, err, string(output))
+	}
+
+	return nil
+}
+
+func RebaseAbort(dir string) error {
+	return runIn(dir, "rebase", "--abort")
+}
+
+func MergeAbort(dir string) error {
+	return runIn(dir, "merge", "--abort")
+}
+
+func CherryPickAbort(dir string) error {
+	return runIn(dir, "cherry-pick", "--abort")
+}
+
+// ResetHard moves the current branch of dir to ref, discarding all changes
+func ResetHard(dir, ref string) error {
+	return runIn(dir, "reset", "--hard", ref)
+}
+
+func HasStagedChanges(dir string) bool {
+	_, err := stdout(dir, "diff", "--cached", "--quiet")
+	return err != nil
+}
+
+func RevParse(dir, ref string) (string, error) {
+	output, err := stdout(dir, "rev-parse", "--verify", ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", ref, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+func runIn(dir string, args ...string) error {
+	output, err := combined(dir, args...)
+	if err != nil {
+		return fmt.Errorf("git %s failed: %w\nOutput: %s", strings.Join(args, " "), err, string(output))
+	}
+
+	return nil
+}
+
+// Conflict is a single path that would conflict when merging, and the kinds of conflict git reported for it
+type Conflict struct {
+	Path     string
+	Types    []string
+	Messages []string
+}
+
+// ConflictReport is the result of merging two refs in memory without touching any worktree
+type ConflictReport struct {
+	Target    string
+	Branch    string
+	Tree      string
+	Conflicts []Conflict
+}
+
+func (r *ConflictReport) HasConflicts() bool {
+	return len(r.Conflicts) > 0
+}
+
+// CheckConflicts merges branch into target in memory with `git merge-tree --write-tree` and reports every
+// path that would conflict, without touching the index or any worktree
+func CheckConflicts(dir, target, branch string) (*ConflictReport, error) {
+	res, err := run(Command{Args: []string{"merge-tree", "--write-tree", "--name-only", "-z", target, branch}, Dir: dir})
+	if err != nil {
+		// merge-tree exits with status 1 when the merge has conflicts
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode != 1 {
+			return nil, fmt.Errorf("failed to check conflicts between %s and %s: %w\nOutput: %s", target, branch, err, string(res.Stderr))
+		}
+	}
+
+	report, err := parseMergeTree(string(res.Stdout))
+	if err != nil {
+		return nil, err
+	}
+	report.Target = target
+	report.Branch = branch
+	return report, nil
+}
+
+// parseMergeTree parses the NUL separated output of `git merge-tree --write-tree --name-only -z`
+func parseMergeTree(output string) (*ConflictReport, error) {
+	fields := strings.Split(output, "\x00")
+	if len(fields) == 0 || fields[0] == "" {
+		return nil, fmt.Errorf("unexpected git merge-tree output: %q", output)
+	}
+
+	report := &ConflictReport{Tree: strings.TrimSpace(fields[0])}
+	byPath := map[string]*Conflict{}
+
+	i := 1
+	for ; i < len(fields) && fields[i] != ""; i++ {
+		report.Conflicts = append(report.Conflicts, Conflict{Path: fields[i]})
+	}
+	for j := range report.Conflicts {
+		byPath[report.Conflicts[j].Path] = &report.Conflicts[j]
+	}
+	i++ // skip the empty field ending the conflicted paths
+
+	// informational messages are <path count> <paths...> <type> <message>
+	for i < len(fields) && fields[i] != "" {
+		count, err := strconv.Atoi(fields[i])
+		if err != nil || i+count+2 >= len(fields) {
+			return nil, fmt.Errorf("unexpected git merge-tree message at %q", fields[i])
+		}
+		paths := fields[i+1 : i+1+count]
+		kind := fields[i+1+count]
+		message := strings.TrimSpace(fields[i+2+count])
+		i += count + 3
+
+		conflictType, ok := strings.CutPrefix(kind, "CONFLICT (")
+		if !ok {
+			continue
+		}
+		conflictType = strings.TrimSuffix(conflictType, ")")
+
+		for _, path := range paths {
+			c, ok := byPath[path]
+			if !ok {
+				continue
+			}
+			if !slices.Contains(c.Types, conflictType) {
+				c.Types = append(c.Types, conflictType)
+			}
+			c.Messages = append(c.Messages, message)
+		}
+	}
+
+	return report, nil
+}
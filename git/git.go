@@ -1,11 +1,15 @@
 package git
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func FindRoot() (string, error) {
@@ -29,10 +33,31 @@ func FindRoot() (string, error) {
 }
 
 func CreateWorktree(gitRoot, worktreePath, branchName string) error {
-	cmd := exec.Command("git", "worktree", "add", "-b", branchName, worktreePath)
-	cmd.Dir = gitRoot
+	return CreateWorktreeFrom(gitRoot, worktreePath, branchName, "")
+}
 
-	output, err := cmd.CombinedOutput()
+// CreateWorktreeFrom adds a worktree on a new branch starting at the start ref, or at HEAD if start is empty
+func CreateWorktreeFrom(gitRoot, worktreePath, branchName, start string) error {
+	args := []string{"worktree", "add", "-b", branchName, worktreePath}
+	if start != "" {
+		args = append(args, start)
+	}
+	output, err := combined(gitRoot, args...)
+	if err != nil {
+		return fmt.Errorf("git worktree add failed: %w\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// CheckoutWorktree adds a worktree on an existing branch. If upstream is given, such as origin/feature, the
+// branch is created from it and set to track it
+func CheckoutWorktree(gitRoot, worktreePath, branchName, upstream string) error {
+	args := []string{"worktree", "add", worktreePath, branchName}
+	if upstream != "" {
+		args = []string{"worktree", "add", "--track", "-b", branchName, worktreePath, upstream}
+	}
+	output, err := combined(gitRoot, args...)
 	if err != nil {
 		return fmt.Errorf("git worktree add failed: %w\nOutput: %s", err, string(output))
 	}
@@ -64,10 +89,7 @@ func UpdateIgnore(gitRoot string, useGitignore bool) error {
 }
 
 func GetCurrentBranch(gitRoot string) (string, error) {
-	cmd := exec.Command("git", "branch", "--show-current")
-	cmd.Dir = gitRoot
-
-	output, err := cmd.Output()
+	output, err := stdout(gitRoot, "branch", "--show-current")
 	if err != nil {
 		return "", fmt.Errorf("failed to get current branch: %w", err)
 	}
@@ -76,10 +98,7 @@ func GetCurrentBranch(gitRoot string) (string, error) {
 }
 
 func SwitchBranch(gitRoot, branchName string) error {
-	cmd := exec.Command("git", "checkout", branchName)
-	cmd.Dir = gitRoot
-
-	output, err := cmd.CombinedOutput()
+	output, err := combined(gitRoot, "checkout", branchName)
 	if err != nil {
 		return fmt.Errorf("failed to switch to branch %s: %w\nOutput: %s", branchName, err, string(output))
 	}
@@ -88,110 +107,462 @@ func SwitchBranch(gitRoot, branchName string) error {
 }
 
 func RebaseOnMain(workingDir string) error {
-	if hasConflicts, err := checkRebaseConflicts(workingDir); err != nil {
-		return fmt.Errorf("failed to check for rebase conflicts: %w", err)
-	} else if hasConflicts {
-		return fmt.Errorf("rebase conflicts detected. resolve conflicts manually first")
+	return RebaseOnBranch(workingDir, "main")
+}
+
+// RebaseOnBranch rebases the current branch of workingDir onto branchName, returning a *ConflictError
+// if the rebase stops on conflicts so that it can be continued or aborted later
+func RebaseOnBranch(workingDir, branchName string) error {
+	output, err := combined(workingDir, "rebase", branchName)
+	if err != nil {
+		if conflictErr := conflictError(workingDir, "rebase", err, output); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to rebase on %s: %w\nOutput: %s", branchName, err, string(output))
 	}
 
-	cmd := exec.Command("git", "rebase", "main")
-	cmd.Dir = workingDir
+	return nil
+}
 
-	output, err := cmd.CombinedOutput()
+func MergeBranch(gitRoot, branchName string) error {
+	output, err := combined(gitRoot, "merge", branchName)
 	if err != nil {
-		return fmt.Errorf("failed to rebase on main: %w\nOutput: %s", err, string(output))
+		if conflictErr := conflictError(gitRoot, "merge", err, output); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to merge branch %s: %w\nOutput: %s", branchName, err, string(output))
 	}
 
 	return nil
 }
 
-func RebaseOnBranch(workingDir, branchName string) error {
-	if hasConflicts, err := checkRebaseConflicts(workingDir); err != nil {
-		return fmt.Errorf("failed to check for rebase conflicts: %w", err)
-	} else if hasConflicts {
-		return fmt.Errorf("rebase conflicts detected. resolve conflicts manually first")
+func RemoveWorktree(gitRoot, worktreePath string) error {
+	output, err := combined(gitRoot, "worktree", "remove", worktreePath)
+	if err != nil {
+		return fmt.Errorf("failed to remove worktree %s: %w\nOutput: %s", worktreePath, err, string(output))
 	}
 
-	cmd := exec.Command("git", "rebase", branchName)
-	cmd.Dir = workingDir
+	return nil
+}
 
-	output, err := cmd.CombinedOutput()
+func DeleteBranch(gitRoot, branchName string) error {
+	output, err := combined(gitRoot, "branch", "-d", branchName)
 	if err != nil {
-		return fmt.Errorf("failed to rebase on %s: %w\nOutput: %s", branchName, err, string(output))
+		return fmt.Errorf("failed to delete branch %s: %w\nOutput: %s", branchName, err, string(output))
 	}
 
 	return nil
 }
 
-func checkRebaseConflicts(workingDir string) (bool, error) {
-	currentBranch, err := GetCurrentBranch(workingDir)
+func HasUncommittedChanges(dir string) (bool, error) {
+	output, err := stdout(dir, "status", "--porcelain")
 	if err != nil {
-		return false, fmt.Errorf("getting current branch: %w", err)
+		return false, fmt.Errorf("failed to check git status: %w", err)
 	}
 
-	cmd := exec.Command("git", "merge-tree", "main", currentBranch)
-	cmd.Dir = workingDir
+	return len(strings.TrimSpace(string(output))) > 0, nil
+}
+
+// Worktree describes a single entry from `git worktree list --porcelain`
+type Worktree struct {
+	Path     string
+	Head     string
+	Branch   string
+	Bare     bool
+	Detached bool
+	Prunable bool
+}
 
-	output, err := cmd.Output()
+func ListWorktrees(gitRoot string) ([]Worktree, error) {
+	output, err := stdout(gitRoot, "worktree", "list", "--porcelain")
 	if err != nil {
-		return true, nil
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
 	}
 
-	conflictMarkers := []string{"<<<<<<<", "=======", ">>>>>>>"}
-	outputStr := string(output)
-	for _, marker := range conflictMarkers {
-		if strings.Contains(outputStr, marker) {
-			return true, nil
+	return parseWorktreeList(string(output)), nil
+}
+
+func parseWorktreeList(output string) []Worktree {
+	var worktrees []Worktree
+	var current *Worktree
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			current = nil
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		if key == "worktree" {
+			worktrees = append(worktrees, Worktree{Path: value})
+			current = &worktrees[len(worktrees)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch key {
+		case "HEAD":
+			current.Head = value
+		case "branch":
+			current.Branch = strings.TrimPrefix(value, "refs/heads/")
+		case "bare":
+			current.Bare = true
+		case "detached":
+			current.Detached = true
+		case "prunable":
+			current.Prunable = true
 		}
 	}
 
-	return false, nil
+	return worktrees
 }
 
-func MergeBranch(gitRoot, branchName string) error {
-	cmd := exec.Command("git", "merge", branchName)
-	cmd.Dir = gitRoot
+// AheadBehind returns how many commits branch is ahead of and behind base
+func AheadBehind(dir, base, branch string) (int, int, error) {
+	output, err := stdout(dir, "rev-list", "--left-right", "--count", base+"..."+branch)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to compare %s with %s: %w", branch, base, err)
+	}
+
+	var behind, ahead int
+	if _, err = fmt.Sscanf(strings.TrimSpace(string(output)), "%d %d", &behind, &ahead); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse rev-list output %q: %w", string(output), err)
+	}
 
-	output, err := cmd.CombinedOutput()
+	return ahead, behind, nil
+}
+
+func ForceRemoveWorktree(gitRoot, worktreePath string) error {
+	output, err := combined(gitRoot, "worktree", "remove", "--force", "--force", worktreePath)
 	if err != nil {
+		return fmt.Errorf("failed to force remove worktree %s: %w\nOutput: %s", worktreePath, err, string(output))
+	}
+
+	return nil
+}
+
+func ForceDeleteBranch(gitRoot, branchName string) error {
+	output, err := combined(gitRoot, "branch", "-D", branchName)
+	if err != nil {
+		return fmt.Errorf("failed to force delete branch %s: %w\nOutput: %s", branchName, err, string(output))
+	}
+
+	return nil
+}
+
+func PruneWorktrees(gitRoot string) error {
+	output, err := combined(gitRoot, "worktree", "prune")
+	if err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
+func BranchExists(gitRoot, branchName string) bool {
+	_, err := stdout(gitRoot, "rev-parse", "--verify", "--quiet", "refs/heads/"+branchName)
+	return err == nil
+}
+
+// CommonDir returns the absolute path of the git directory shared by the repository and all of its worktrees
+func CommonDir(gitRoot string) (string, error) {
+	output, err := stdout(gitRoot, "rev-parse", "--path-format=absolute", "--git-common-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to get git common dir: %w", err)
+	}
+
+	return filepath.Clean(strings.TrimSpace(string(output))), nil
+}
+
+// WorktreeGitDir reads the gitdir a linked worktree's .git file points at
+func WorktreeGitDir(worktreePath string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(worktreePath, ".git"))
+	if err != nil {
+		return "", err
+	}
+
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("%s is not a linked worktree", worktreePath)
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(worktreePath, gitDir)
+	}
+
+	return filepath.Clean(gitDir), nil
+}
+
+// RepoID returns a stable identifier for a repository, shared by all of its worktrees, of the form <repo-name>-<hash>
+func RepoID(gitRoot string) (string, error) {
+	commonDir, err := CommonDir(gitRoot)
+	if err != nil {
+		return "", err
+	}
+	return repoIDFromCommonDir(commonDir), nil
+}
+
+func repoIDFromCommonDir(commonDir string) string {
+	sum := sha256.Sum256([]byte(commonDir))
+	return fmt.Sprintf("%s-%s", repoNameFromCommonDir(commonDir), hex.EncodeToString(sum[:])[:12])
+}
+
+// RepoName returns the name of the repository's main directory, which is the same from any of its worktrees
+func RepoName(gitRoot string) (string, error) {
+	commonDir, err := CommonDir(gitRoot)
+	if err != nil {
+		return "", err
+	}
+	return repoNameFromCommonDir(commonDir), nil
+}
+
+func repoNameFromCommonDir(commonDir string) string {
+	name := filepath.Base(commonDir)
+	if name == ".git" {
+		name = filepath.Base(filepath.Dir(commonDir))
+	}
+	return strings.TrimSuffix(name, ".git")
+}
+
+func MergeBranchNoFF(gitRoot, branchName string) error {
+	output, err := combined(gitRoot, "merge", "--no-ff", "--no-edit", branchName)
+	if err != nil {
+		if conflictErr := conflictError(gitRoot, "merge", err, output); conflictErr != nil {
+			return conflictErr
+		}
 		return fmt.Errorf("failed to merge branch %s: %w\nOutput: %s", branchName, err, string(output))
 	}
 
 	return nil
 }
 
-func RemoveWorktree(gitRoot, worktreePath string) error {
-	cmd := exec.Command("git", "worktree", "remove", worktreePath)
-	cmd.Dir = gitRoot
+// SquashMerge stages the combined changes of branchName on the current branch and commits them as a single commit
+func SquashMerge(gitRoot, branchName, message string) error {
+	output, err := combined(gitRoot, "merge", "--squash", branchName)
+	if err != nil {
+		if conflictErr := conflictError(gitRoot, "merge", err, output); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to squash merge branch %s: %w\nOutput: %s", branchName, err, string(output))
+	}
 
-	output, err := cmd.CombinedOutput()
+	return Commit(gitRoot, message)
+}
+
+func Commit(dir, message string) error {
+	res, err := run(Command{Args: []string{"commit", "--file", "-"}, Dir: dir, Stdin: strings.NewReader(message)})
 	if err != nil {
-		return fmt.Errorf("failed to remove worktree %s: %w\nOutput: %s", worktreePath, err, string(output))
+		return fmt.Errorf("failed to commit: %w\nOutput: %s", err, res.Output())
 	}
 
 	return nil
 }
 
-func DeleteBranch(gitRoot, branchName string) error {
-	cmd := exec.Command("git", "branch", "-d", branchName)
-	cmd.Dir = gitRoot
+// CherryPick applies every commit on branchName that is not on the current branch, in order
+func CherryPick(gitRoot, branchName string) error {
+	output, err := combined(gitRoot, "cherry-pick", "HEAD.."+branchName)
+	if err != nil {
+		if conflictErr := conflictError(gitRoot, "cherry-pick", err, output); conflictErr != nil {
+			return conflictErr
+		}
+		return fmt.Errorf("failed to cherry-pick %s: %w\nOutput: %s", branchName, err, string(output))
+	}
 
-	output, err := cmd.CombinedOutput()
+	return nil
+}
+
+// CommitSubjects returns the subject line of every commit on branch that is not on base, oldest first
+func CommitSubjects(dir, base, branch string) ([]string, error) {
+	output, err := stdout(dir, "log", "--reverse", "--format=%s", base+".."+branch)
 	if err != nil {
-		return fmt.Errorf("failed to delete branch %s: %w\nOutput: %s", branchName, err, string(output))
+		return nil, fmt.Errorf("failed to list commits on %s: %w", branch, err)
+	}
+
+	trimmed := strings.TrimSpace(string(output))
+	if trimmed == "" {
+		return nil, nil
+	}
+	return strings.Split(trimmed, "\n"), nil
+}
+
+// MergeBase returns the best common ancestor of all the given refs
+func MergeBase(dir string, refs ...string) (string, error) {
+	args := append([]string{"merge-base", "--octopus"}, refs...)
+	output, err := stdout(dir, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to find merge base of %s: %w", strings.Join(refs, ", "), err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ChangedFiles lists the paths that differ between two commits
+func ChangedFiles(dir, from, to string) ([]string, error) {
+	output, err := stdout(dir, "diff", "--name-only", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files changed between %s and %s: %w", from, to, err)
+	}
+
+	trimmed := strings.TrimSpace(string(output))
+	if trimmed == "" {
+		return nil, nil
+	}
+	return strings.Split(trimmed, "\n"), nil
+}
+
+// DiffStat returns the `git diff --stat` summary of the changes between two commits
+func DiffStat(dir, from, to string) (string, error) {
+	output, err := stdout(dir, "diff", "--stat", from, to)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s and %s: %w", from, to, err)
+	}
+
+	return strings.TrimRight(string(output), "\n"), nil
+}
+
+// Diff returns the full diff between two commits
+func Diff(dir, from, to string) (string, error) {
+	output, err := stdout(dir, "diff", from, to)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s and %s: %w", from, to, err)
+	}
+
+	return string(output), nil
+}
+
+// DiffWorktree returns the diff from a commit to the worktree in dir, including uncommitted changes. With
+// color, it is colored as git's own pager would show it.
+func DiffWorktree(dir, from string, color bool) (string, error) {
+	args := []string{"diff", from}
+	if color {
+		args = []string{"diff", "--color=always", from}
+	}
+	output, err := stdout(dir, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s against the worktree: %w", from, err)
+	}
+
+	return string(output), nil
+}
+
+// CommitTime returns when the commit ref points at was made
+func CommitTime(dir, ref string) (time.Time, error) {
+	output, err := stdout(dir, "log", "-1", "--format=%ct", ref)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read commit time of %s: %w", ref, err)
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse commit time %q: %w", string(output), err)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// IgnoredFiles lists the untracked files git ignores in dir. Directories that are ignored as a whole
+// are listed once, with a trailing slash, rather than file by file.
+func IgnoredFiles(dir string) ([]string, error) {
+	output, err := stdout(dir, "ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory", "--no-empty-directory")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ignored files: %w", err)
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(output), "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// IsIgnored reports whether git ignores path, relative to dir, whether or not it is tracked
+func IsIgnored(dir, path string) bool {
+	_, err := stdout(dir, "check-ignore", "--quiet", "--no-index", path)
+	return err == nil
+}
+
+// Exclude adds patterns missing from the info/exclude file shared by the repository and all of its worktrees
+func Exclude(gitRoot string, patterns []string) error {
+	commonDir, err := CommonDir(gitRoot)
+	if err != nil {
+		return err
+	}
+
+	excludePath := filepath.Join(commonDir, "info", "exclude")
+	if err = os.MkdirAll(filepath.Dir(excludePath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(excludePath), err)
+	}
+
+	content := ""
+	if data, err := os.ReadFile(excludePath); err == nil {
+		content = string(data)
+	}
+	existing := strings.Split(content, "\n")
+
+	added := false
+	for _, pattern := range patterns {
+		if slices.Contains(existing, pattern) {
+			continue
+		}
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += pattern + "\n"
+		existing = append(existing, pattern)
+		added = true
+	}
+	if !added {
+		return nil
+	}
+
+	return os.WriteFile(excludePath, []byte(content), 0644)
+}
+
+// ResolveCommit returns the commit a branch, tag, commit or other ref points at
+func ResolveCommit(dir, ref string) (string, error) {
+	output, err := stdout(dir, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown ref '%s'", ref)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// FetchRef fetches ref from remote into the same ref locally, for refs such as refs/pull/123/head
+// that aren't fetched by default
+func FetchRef(dir, remote, ref string) error {
+	output, err := combined(dir, "fetch", remote, "+"+ref+":"+ref)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s from %s: %w\nOutput: %s", ref, remote, err, string(output))
 	}
 
 	return nil
 }
 
-func HasUncommittedChanges(dir string) (bool, error) {
-	cmd := exec.Command("git", "status", "--porcelain")
-	cmd.Dir = dir
+// FetchBranch fetches branch from remote into its remote-tracking branch
+func FetchBranch(dir, remote, branch string) error {
+	output, err := combined(dir, "fetch", remote, "+refs/heads/"+branch+":refs/remotes/"+remote+"/"+branch)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s from %s: %w\nOutput: %s", branch, remote, err, string(output))
+	}
+
+	return nil
+}
 
-	output, err := cmd.Output()
+// Remotes returns the names of the repository's remotes
+func Remotes(gitRoot string) ([]string, error) {
+	output, err := stdout(gitRoot, "remote")
 	if err != nil {
-		return false, fmt.Errorf("failed to check git status: %w", err)
+		return nil, fmt.Errorf("failed to list remotes: %w", err)
 	}
 
-	return len(strings.TrimSpace(string(output))) > 0, nil
+	return strings.Fields(string(output)), nil
+}
+
+// RemoteBranchExists reports whether ref, such as origin/main, is a remote-tracking branch
+func RemoteBranchExists(gitRoot, ref string) bool {
+	_, err := stdout(gitRoot, "rev-parse", "--verify", "--quiet", "refs/remotes/"+ref)
+	return err == nil
 }
@@ -3,6 +3,7 @@ package git
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -203,3 +204,194 @@ func TestHasUncommittedChanges(t *testing.T) {
 		t.Error("HasUncommittedChanges() should return false for non-git directory")
 	}
 }
+
+func TestParseWorktreeList(t *testing.T) {
+	output := `worktree /home/user/project
+HEAD 1111111111111111111111111111111111111111
+branch refs/heads/main
+
+worktree /home/user/.local/share/treeai/feature
+HEAD 2222222222222222222222222222222222222222
+branch refs/heads/feature
+
+worktree /home/user/.local/share/treeai/detached
+HEAD 3333333333333333333333333333333333333333
+detached
+prunable gitdir file points to non-existent location
+
+`
+
+	got := parseWorktreeList(output)
+	want := []Worktree{
+		{Path: "/home/user/project", Head: "1111111111111111111111111111111111111111", Branch: "main"},
+		{Path: "/home/user/.local/share/treeai/feature", Head: "2222222222222222222222222222222222222222", Branch: "feature"},
+		{Path: "/home/user/.local/share/treeai/detached", Head: "3333333333333333333333333333333333333333", Detached: true, Prunable: true},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("parseWorktreeList() returned %d worktrees, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseWorktreeList()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestRepoIDFromCommonDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		commonDir  string
+		wantPrefix string
+	}{
+		{
+			name:       "uses the repository directory name for a .git dir",
+			commonDir:  "/home/user/myproject/.git",
+			wantPrefix: "myproject-",
+		},
+		{
+			name:       "strips the .git suffix from bare repositories",
+			commonDir:  "/srv/git/myproject.git",
+			wantPrefix: "myproject-",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := repoIDFromCommonDir(tt.commonDir)
+			if !strings.HasPrefix(got, tt.wantPrefix) || len(got) != len(tt.wantPrefix)+12 {
+				t.Errorf("repoIDFromCommonDir() = %v, want %v followed by a 12 character hash", got, tt.wantPrefix)
+			}
+			if got != repoIDFromCommonDir(tt.commonDir) {
+				t.Error("repoIDFromCommonDir() should be stable")
+			}
+		})
+	}
+
+	if repoIDFromCommonDir("/a/myproject/.git") == repoIDFromCommonDir("/b/myproject/.git") {
+		t.Error("repoIDFromCommonDir() should differ for repositories with the same name")
+	}
+}
+
+func TestParseMergeTree(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []Conflict
+	}{
+		{
+			name:   "clean merge",
+			output: "7cfeafccb84e3edc2e5c9d441137284013f79e4b\x00\x00",
+			want:   nil,
+		},
+		{
+			name: "content and modify/delete conflicts",
+			output: "bf592c854b4ad6e0013ab1e81759b2ec83c0e8e5\x00a\x00c\x00\x00" +
+				"1\x00a\x00CONFLICT (modify/delete)\x00CONFLICT (modify/delete): a deleted in side and modified in main.\n\x00" +
+				"1\x00c\x00Auto-merging\x00Auto-merging c\n\x00" +
+				"1\x00c\x00CONFLICT (contents)\x00CONFLICT (add/add): Merge conflict in c\n\x00",
+			want: []Conflict{
+				{Path: "a", Types: []string{"modify/delete"}, Messages: []string{"CONFLICT (modify/delete): a deleted in side and modified in main."}},
+				{Path: "c", Types: []string{"contents"}, Messages: []string{"CONFLICT (add/add): Merge conflict in c"}},
+			},
+		},
+		{
+			name: "file containing a line of equals signs",
+			output: "7cfeafccb84e3edc2e5c9d441137284013f79e4b\x00\x00" +
+				"1\x00README.md\x00Auto-merging\x00Auto-merging README.md\n\x00",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMergeTree(tt.output)
+			if err != nil {
+				t.Fatalf("parseMergeTree() error = %v", err)
+			}
+			if got.HasConflicts() != (len(tt.want) > 0) {
+				t.Errorf("parseMergeTree().HasConflicts() = %v, want %v", got.HasConflicts(), len(tt.want) > 0)
+			}
+			if len(got.Conflicts) != len(tt.want) {
+				t.Fatalf("parseMergeTree() returned %d conflicts, want %d", len(got.Conflicts), len(tt.want))
+			}
+			for i, want := range tt.want {
+				c := got.Conflicts[i]
+				if c.Path != want.Path || strings.Join(c.Types, ",") != strings.Join(want.Types, ",") || strings.Join(c.Messages, "\n") != strings.Join(want.Messages, "\n") {
+					t.Errorf("parseMergeTree().Conflicts[%d] = %+v, want %+v", i, c, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFakeRunner(t *testing.T) {
+	fake := &FakeRunner{}
+	defer SetRunner(fake)()
+
+	fake.Stub([]string{"rev-list"}, "2\t5\n")
+	fake.StubError([]string{"branch", "-d"}, 1, "error: the branch 'feature' is not fully merged\n")
+
+	ahead, behind, err := AheadBehind("/repo", "main", "feature")
+	if err != nil {
+		t.Fatalf("AheadBehind() error = %v", err)
+	}
+	if ahead != 5 || behind != 2 {
+		t.Errorf("AheadBehind() = %d, %d, want 5, 2", ahead, behind)
+	}
+
+	err = DeleteBranch("/repo", "feature")
+	if err == nil || !strings.Contains(err.Error(), "not fully merged") {
+		t.Errorf("DeleteBranch() error = %v, want stubbed stderr in error", err)
+	}
+
+	if err = Commit("/tree", "subject\n\nbody\n"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 3 {
+		t.Fatalf("FakeRunner recorded %d calls, want 3: %v", len(calls), fake.Commands())
+	}
+	if calls[0].Dir != "/repo" || strings.Join(calls[0].Args, " ") != "rev-list --left-right --count main...feature" {
+		t.Errorf("first call = %+v", calls[0].Command)
+	}
+	if calls[2].Dir != "/tree" || calls[2].Stdin != "subject\n\nbody\n" {
+		t.Errorf("commit call = %+v, stdin %q", calls[2].Command, calls[2].Stdin)
+	}
+}
+
+func TestCheckConflictsExitStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		stdout        string
+		exitCode      int
+		wantErr       bool
+		wantConflicts bool
+	}{
+		{name: "exit status 0 is a clean merge", stdout: "abc\x00\x00"},
+		{name: "exit status 1 reports conflicts", stdout: "abc\x00a\x00\x00", exitCode: 1, wantConflicts: true},
+		{name: "other exit statuses are errors", exitCode: 128, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &FakeRunner{}
+			defer SetRunner(fake)()
+
+			var err error
+			if tt.exitCode != 0 {
+				err = &ExitError{ExitCode: tt.exitCode}
+			}
+			fake.StubResult([]string{"merge-tree"}, Result{Stdout: []byte(tt.stdout)}, err)
+
+			report, err := CheckConflicts("/repo", "main", "feature")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckConflicts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && report.HasConflicts() != tt.wantConflicts {
+				t.Errorf("CheckConflicts().HasConflicts() = %v, want %v", report.HasConflicts(), tt.wantConflicts)
+			}
+		})
+	}
+}
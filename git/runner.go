@@ -0,0 +1,191 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Command is a single git invocation
+type Command struct {
+	Args  []string
+	Dir   string
+	Env   []string // added to the current environment
+	Stdin io.Reader
+}
+
+// Result is the captured output of a git invocation
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+}
+
+// Output returns stdout followed by stderr, for error messages
+func (r Result) Output() string {
+	return string(r.Stdout) + string(r.Stderr)
+}
+
+// ExitError is returned by a Runner when git exits with a non-zero status
+type ExitError struct {
+	Command  Command
+	ExitCode int
+	Stderr   []byte
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.ExitCode)
+}
+
+// Runner executes git commands. Every function in this package runs git through the package Runner.
+type Runner interface {
+	Run(cmd Command) (Result, error)
+}
+
+// ExecRunner runs the git binary on the PATH
+type ExecRunner struct{}
+
+func (ExecRunner) Run(c Command) (Result, error) {
+	cmd := exec.Command("git", c.Args...)
+	cmd.Dir = c.Dir
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Stdin = c.Stdin
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	res := Result{Stdout: stdout.Bytes(), Stderr: stderr.Bytes()}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return res, &ExitError{Command: c, ExitCode: exitErr.ExitCode(), Stderr: res.Stderr}
+	}
+	return res, err
+}
+
+var (
+	runnerMu sync.RWMutex
+	runner   Runner = ExecRunner{}
+)
+
+// SetRunner replaces the Runner used by this package and returns a func that restores the previous one
+func SetRunner(r Runner) func() {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+
+	previous := runner
+	runner = r
+	return func() {
+		runnerMu.Lock()
+		defer runnerMu.Unlock()
+		runner = previous
+	}
+}
+
+func run(c Command) (Result, error) {
+	runnerMu.RLock()
+	r := runner
+	runnerMu.RUnlock()
+	return r.Run(c)
+}
+
+// stdout runs git in dir and returns its stdout
+func stdout(dir string, args ...string) ([]byte, error) {
+	res, err := run(Command{Args: args, Dir: dir})
+	return res.Stdout, err
+}
+
+// combined runs git in dir and returns its stdout followed by its stderr
+func combined(dir string, args ...string) ([]byte, error) {
+	res, err := run(Command{Args: args, Dir: dir})
+	return []byte(res.Output()), err
+}
+
+// Call is a command received by a FakeRunner and the reply it gave
+type Call struct {
+	Command
+	Stdin  string
+	Result Result
+	Err    error
+}
+
+// FakeRunner records every command it receives and replies with stubbed results, so code built on
+// this package can be tested without a git binary or repository. Unstubbed commands succeed with no output.
+type FakeRunner struct {
+	mu    sync.Mutex
+	stubs []stub
+	calls []Call
+}
+
+type stub struct {
+	args   []string
+	result Result
+	err    error
+}
+
+// StubResult replies with result and err to every command whose arguments start with args. Later stubs take precedence.
+func (f *FakeRunner) StubResult(args []string, result Result, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stubs = append(f.stubs, stub{args: args, result: result, err: err})
+}
+
+// Stub succeeds with stdout for every command whose arguments start with args
+func (f *FakeRunner) Stub(args []string, stdout string) {
+	f.StubResult(args, Result{Stdout: []byte(stdout)}, nil)
+}
+
+// StubError fails every command whose arguments start with args with the given exit code and stderr
+func (f *FakeRunner) StubError(args []string, exitCode int, stderr string) {
+	f.StubResult(args, Result{Stderr: []byte(stderr)}, &ExitError{Command: Command{Args: args}, ExitCode: exitCode, Stderr: []byte(stderr)})
+}
+
+func (f *FakeRunner) Run(c Command) (Result, error) {
+	call := Call{Command: c}
+	if c.Stdin != nil {
+		data, _ := io.ReadAll(c.Stdin)
+		call.Stdin = string(data)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := len(f.stubs) - 1; i >= 0; i-- {
+		s := f.stubs[i]
+		if len(c.Args) >= len(s.args) && slices.Equal(c.Args[:len(s.args)], s.args) {
+			call.Result, call.Err = s.result, s.err
+			break
+		}
+	}
+
+	f.calls = append(f.calls, call)
+	return call.Result, call.Err
+}
+
+// Calls returns every command the FakeRunner has received, in order
+func (f *FakeRunner) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+// Commands returns the arguments of every command the FakeRunner has received, joined with spaces
+func (f *FakeRunner) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	commands := make([]string, len(f.calls))
+	for i, call := range f.calls {
+		commands[i] = strings.Join(call.Args, " ")
+	}
+	return commands
+}
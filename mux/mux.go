@@ -0,0 +1,53 @@
+package mux
+
+// Target identifies a session, or a window within a session, that a tree's agent runs in
+type Target struct {
+	Name   string
+	Window bool
+}
+
+// Session is a running multiplexer session and the directory it was started in, if known
+type Session struct {
+	Name string
+	Path string
+}
+
+// Workspace describes a session or window to create for a tree
+type Workspace struct {
+	// Name of the new session or window
+	Name string
+	// Dir is the working directory of every pane in the workspace
+	Dir string
+	// Command is typed into the shell of the first pane, so the shell survives it exiting
+	Command string
+	// Commands each get an additional window running the command
+	Commands []string
+	// Window opens a window rather than a new session
+	Window bool
+	// Session to open the window in. Empty means the current session.
+	Session string
+	// Background leaves focus where it is rather than switching to a new window
+	Background bool
+}
+
+// Multiplexer is a terminal multiplexer that trees can be opened in
+type Multiplexer interface {
+	Name() string
+	CheckInstalled() error
+	// CurrentSession returns the session treeai is running inside, or "" when outside the multiplexer
+	CurrentSession() (string, error)
+	// SessionName derives the session name for a tree from the current session or the git root
+	SessionName(gitRoot, worktreeName string) (string, error)
+	CreateWorkspace(ws Workspace) (Target, error)
+	// SendInput types text into the target's first pane and presses enter
+	SendInput(target Target, text string) error
+	// Switch focuses the target, attaching to it when outside the multiplexer
+	Switch(target Target) error
+	Kill(target Target) error
+	// Capture returns the visible contents of the target's first pane
+	Capture(target Target) (string, error)
+	Alive(target Target) bool
+	// Message briefly shows text in the status line of clients attached to the target
+	Message(target Target, text string) error
+	ListSessions() ([]Session, error)
+}
@@ -0,0 +1,134 @@
+package prompt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// Read returns the contents of a prompt file, or of stdin when path is "-"
+func Read(path string) (string, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt from stdin: %w", err)
+		}
+		return string(data), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file: %w", err)
+	}
+	return string(data), nil
+}
+
+// Scissors separates the prompt from the instructions Edit appends below it. Only what is above it is kept, so
+// lines of the prompt starting with '#', like markdown headings, survive.
+const Scissors = "# ------------------------ >8 ------------------------"
+
+// Edit opens the user's editor on a temporary file holding initial, followed by instructions below a scissors
+// line, and returns what was saved above the scissors line, the same way `git commit --cleanup=scissors` does.
+func Edit(initial, instructions string) (string, error) {
+	f, err := os.CreateTemp("", "treeai-prompt-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	content := initial
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "\n" + Scissors + "\n# Do not modify or remove the line above.\n# Everything below it will be ignored.\n"
+	for _, line := range strings.Split(strings.TrimRight(instructions, "\n"), "\n") {
+		content += strings.TrimRight("# "+line, " ") + "\n"
+	}
+
+	if _, err = f.WriteString(content); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	}
+
+	editor := Editor()
+	// like git, run the editor through the shell so that $EDITOR can include arguments
+	editCmd := exec.Command("sh", "-c", editor+` "$@"`, editor, f.Name())
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	if err = editCmd.Run(); err != nil {
+		return "", fmt.Errorf("editor '%s' failed: %w", editor, err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file: %w", err)
+	}
+	return Clean(string(data)), nil
+}
+
+// Editor returns the editor to use, checking the same variables as git
+func Editor() string {
+	for _, name := range []string{"TREEAI_EDITOR", "VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// Clean drops everything from the scissors line on, then strips trailing whitespace, leading and trailing
+// blank lines, and runs of blank lines. Lines starting with '#' are kept.
+func Clean(text string) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		if line == Scissors {
+			break
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseVars parses key=value pairs given with --var
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid variable '%s', expected key=value", pair)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// Render executes a prompt template. Referencing a variable that was not given is an error.
+func Render(name, text string, data map[string]any) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template '%s': %w", name, err)
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render template '%s': %w", name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
@@ -0,0 +1,84 @@
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"cuts at the scissors line", "fix the bug\n" + Scissors + "\n# Enter the prompt\nmore\n", "fix the bug"},
+		{"keeps headings", "# Task\nfix the bug\n\n## Constraints\n", "# Task\nfix the bug\n\n## Constraints"},
+		{"collapses blank lines", "\n\nfirst\n\n\n\nsecond  \n\n", "first\n\nsecond"},
+		{"only instructions", "\n" + Scissors + "\n# nothing here\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Clean(tt.text); got != tt.want {
+				t.Errorf("Clean() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEdit(t *testing.T) {
+	seen := filepath.Join(t.TempDir(), "seen")
+	// the editor records what it was given and appends a line, as a user would
+	t.Setenv("TREEAI_EDITOR", `cp "$1" `+seen+` && printf 'and add tests\n' >>`)
+
+	got, err := Edit("# Task\nfix the bug", "Enter the prompt for 'feat'.")
+	if err != nil {
+		t.Fatalf("Edit() error = %v", err)
+	}
+	// the line the editor appends lands below the scissors line, so it is dropped with the instructions
+	if want := "# Task\nfix the bug"; got != want {
+		t.Errorf("Edit() = %q, want %q", got, want)
+	}
+
+	initial, err := os.ReadFile(seen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Task\nfix the bug\n\n" + Scissors + "\n# Do not modify or remove the line above.\n# Everything below it will be ignored.\n# Enter the prompt for 'feat'.\n"
+	if string(initial) != want {
+		t.Errorf("Edit() opened the editor on %q, want %q", initial, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	data := map[string]any{"Branch": "fix-login", "Base": "main", "Prompt": "the form resets", "issue": "123"}
+
+	got, err := Render("review-fix", "Fix issue #{{.issue}} on {{.Branch}}: {{.Prompt}}\n\nRebase on {{.Base}} before finishing.\n", data)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if want := "Fix issue #123 on fix-login: the form resets\n\nRebase on main before finishing."; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	if _, err = Render("review-fix", "Fix {{.ticket}}", data); err == nil {
+		t.Error("Render() with a variable that was not given should fail")
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	vars, err := ParseVars([]string{"issue=123", "title=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("ParseVars() error = %v", err)
+	}
+	if vars["issue"] != "123" || vars["title"] != "a=b" || vars["empty"] != "" || len(vars) != 3 {
+		t.Errorf("ParseVars() = %v", vars)
+	}
+
+	for _, bad := range []string{"issue", "=123"} {
+		if _, err = ParseVars([]string{bad}); err == nil {
+			t.Errorf("ParseVars(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const (
+	registryFile = "registry.json"
+	lockFile     = "registry.lock"
+)
+
+// Tree is everything treeai knows about a worktree at the time it was created
+type Tree struct {
+	Name          string    `json:"name"`
+	Path          string    `json:"path"`
+	Repo          string    `json:"repo"`
+	RepoID        string    `json:"repo_id"`
+	Branch        string    `json:"branch"`
+	Base          string    `json:"base"`
+	From          string    `json:"from,omitempty"`
+	Prompt        string    `json:"prompt,omitempty"`
+	Agent         string    `json:"agent,omitempty"`
+	Bin           string    `json:"bin"`
+	Multiplexer   string    `json:"multiplexer,omitempty"`
+	Session       string    `json:"session"`
+	Window        bool      `json:"window"`
+	OriginSession string    `json:"origin_session,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	Merge         *Merge    `json:"merge,omitempty"`
+	Headless      *Process  `json:"headless,omitempty"`
+	Activity      *Activity `json:"activity,omitempty"`
+	// ExistingBranch is set for trees opened on a branch that existed before them, which removing the tree keeps
+	ExistingBranch bool `json:"existing_branch,omitempty"`
+}
+
+// Activity is the last output seen from a tree's agent, so whether it has gone idle can be judged across commands
+type Activity struct {
+	Hash      string    `json:"hash"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Process is a headless agent running as a supervised background process instead of in a multiplexer
+type Process struct {
+	PID        int        `json:"pid"`
+	Supervisor int        `json:"supervisor_pid"`
+	Log        string     `json:"log"`
+	PromptVia  string     `json:"prompt_via"`
+	StartedAt  time.Time  `json:"started_at"`
+	ExitCode   *int       `json:"exit_code,omitempty"`
+	ExitedAt   *time.Time `json:"exited_at,omitempty"`
+}
+
+// Running reports whether the agent has not yet been seen to exit
+func (p *Process) Running() bool {
+	return p.ExitCode == nil
+}
+
+// Merge records a merge that stopped part way through, so it can be continued or aborted
+type Merge struct {
+	Step           string    `json:"step"`
+	Strategy       string    `json:"strategy"`
+	Target         string    `json:"target"`
+	OrigRootBranch string    `json:"orig_root_branch"`
+	OrigRootHead   string    `json:"orig_root_head"`
+	OrigTreeHead   string    `json:"orig_tree_head"`
+	Conflicts      []string  `json:"conflicts"`
+	ConflictWindow string    `json:"conflict_window,omitempty"`
+	StartedAt      time.Time `json:"started_at"`
+}
+
+// Registry is the persisted set of trees, keyed by worktree path
+type Registry struct {
+	Trees map[string]*Tree `json:"trees"`
+}
+
+func Path(dataDir string) string {
+	return filepath.Join(dataDir, registryFile)
+}
+
+// Load reads the registry under a shared lock. A missing registry is returned empty.
+func Load(dataDir string) (*Registry, error) {
+	unlock, err := lock(dataDir, syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return read(dataDir)
+}
+
+// Update applies fn to the registry under an exclusive lock and writes the result back
+func Update(dataDir string, fn func(*Registry) error) error {
+	unlock, err := lock(dataDir, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err := read(dataDir)
+	if err != nil {
+		return err
+	}
+
+	if err = fn(r); err != nil {
+		return err
+	}
+
+	return write(dataDir, r)
+}
+
+func (r *Registry) Get(path string) (*Tree, bool) {
+	t, ok := r.Trees[filepath.Clean(path)]
+	return t, ok
+}
+
+func (r *Registry) Put(t *Tree) {
+	t.Path = filepath.Clean(t.Path)
+	r.Trees[t.Path] = t
+}
+
+func (r *Registry) Remove(path string) {
+	delete(r.Trees, filepath.Clean(path))
+}
+
+// ForRepo returns the trees created from the repository identified by repoID, ordered by name
+func (r *Registry) ForRepo(repoID string) []*Tree {
+	var trees []*Tree
+	for _, t := range r.Trees {
+		if t.RepoID == repoID {
+			trees = append(trees, t)
+		}
+	}
+	sort.Slice(trees, func(i, j int) bool { return trees[i].Name < trees[j].Name })
+	return trees
+}
+
+func lock(dataDir string, how int) (func(), error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dataDir, lockFile), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening registry lock: %w", err)
+	}
+
+	if err = syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking registry: %w", err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func read(dataDir string) (*Registry, error) {
+	r := &Registry{Trees: map[string]*Tree{}}
+
+	data, err := os.ReadFile(Path(dataDir))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading registry: %w", err)
+	}
+
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("error parsing registry %s: %w", Path(dataDir), err)
+	}
+	if r.Trees == nil {
+		r.Trees = map[string]*Tree{}
+	}
+
+	return r, nil
+}
+
+func write(dataDir string, r *Registry) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding registry: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dataDir, registryFile+".*")
+	if err != nil {
+		return fmt.Errorf("error writing registry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing registry: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error writing registry: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), Path(dataDir)); err != nil {
+		return fmt.Errorf("error writing registry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadMissingRegistry(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "registry-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	r, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(r.Trees) != 0 {
+		t.Errorf("Load() returned %d trees, want 0", len(r.Trees))
+	}
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "registry-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	trees := []*Tree{
+		{Name: "b-tree", Path: filepath.Join(tmpDir, "b-tree"), Repo: "/repo", RepoID: "repo-1", Branch: "b-tree", Base: "main", CreatedAt: created},
+		{Name: "a-tree", Path: filepath.Join(tmpDir, "a-tree") + "/", Repo: "/repo", RepoID: "repo-1", Branch: "a-tree", Base: "main", Window: true},
+		{Name: "other", Path: filepath.Join(tmpDir, "other"), Repo: "/other-repo", RepoID: "other-repo-2", Branch: "other", Base: "dev"},
+	}
+
+	err = Update(tmpDir, func(r *Registry) error {
+		for _, tree := range trees {
+			r.Put(tree)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	r, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	got, ok := r.Get(filepath.Join(tmpDir, "b-tree"))
+	if !ok {
+		t.Fatal("Get() did not find b-tree")
+	}
+	if got.Base != "main" || !got.CreatedAt.Equal(created) {
+		t.Errorf("Get() = %+v, want base main created at %v", got, created)
+	}
+
+	if _, ok = r.Get(filepath.Join(tmpDir, "a-tree")); !ok {
+		t.Error("Get() should match paths regardless of trailing separators")
+	}
+
+	repoTrees := r.ForRepo("repo-1")
+	if len(repoTrees) != 2 || repoTrees[0].Name != "a-tree" || repoTrees[1].Name != "b-tree" {
+		t.Errorf("ForRepo() = %+v, want a-tree and b-tree in order", repoTrees)
+	}
+
+	err = Update(tmpDir, func(r *Registry) error {
+		r.Remove(filepath.Join(tmpDir, "b-tree"))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	r, err = Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, ok = r.Get(filepath.Join(tmpDir, "b-tree")); ok {
+		t.Error("Remove() did not remove b-tree")
+	}
+}
@@ -0,0 +1,330 @@
+package screen
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jesses-code-adventures/treeai/mux"
+)
+
+// Screen is the GNU screen implementation of mux.Multiplexer. Windows are addressed as session:title.
+type Screen struct{}
+
+var _ mux.Multiplexer = Screen{}
+
+func (Screen) Name() string {
+	return "screen"
+}
+
+func (Screen) CheckInstalled() error {
+	if _, err := exec.LookPath("screen"); err != nil {
+		return fmt.Errorf(`screen is not installed or not in PATH
+
+To install GNU screen:
+  • macOS: brew install screen
+  • Ubuntu/Debian: sudo apt install screen
+  • CentOS/RHEL: sudo yum install screen
+  • Arch Linux: sudo pacman -S screen`)
+	}
+	return nil
+}
+
+// CurrentSession returns the name of the screen session treeai is running in, without its pid prefix
+func (Screen) CurrentSession() (string, error) {
+	return sessionFromSTY(os.Getenv("STY")), nil
+}
+
+func sessionFromSTY(sty string) string {
+	if _, name, ok := strings.Cut(sty, "."); ok {
+		return name
+	}
+	return sty
+}
+
+func (s Screen) SessionName(gitRoot, worktreeName string) (string, error) {
+	base, _ := s.CurrentSession()
+	if base == "" {
+		base = filepath.Base(gitRoot)
+	}
+	return fmt.Sprintf("%s-%s", base, worktreeName), nil
+}
+
+func (s Screen) CreateWorkspace(ws mux.Workspace) (mux.Target, error) {
+	if ws.Window {
+		return s.createWindow(ws)
+	}
+	return s.createSession(ws)
+}
+
+func (s Screen) createSession(ws mux.Workspace) (mux.Target, error) {
+	target := mux.Target{Name: ws.Name}
+	if s.Alive(target) {
+		return target, fmt.Errorf("screen session '%s' already exists", ws.Name)
+	}
+
+	createCmd := exec.Command("screen", "-dmS", ws.Name)
+	createCmd.Dir = ws.Dir
+	if err := createCmd.Run(); err != nil {
+		return target, fmt.Errorf("failed to create screen session: %w", err)
+	}
+
+	if ws.Command != "" {
+		if err := stuff(ws.Name, "0", ws.Command); err != nil {
+			return target, fmt.Errorf("failed to send binary command: %w", err)
+		}
+	}
+
+	if err := run(ws.Name, "", "chdir", ws.Dir); err != nil {
+		return target, err
+	}
+	for i, command := range ws.Commands {
+		title := fmt.Sprintf("command-%d", i+1)
+		if err := run(ws.Name, "", "screen", "-t", title, "bash", "-c", command); err != nil {
+			return target, fmt.Errorf("failed to create window with command '%s': %w", command, err)
+		}
+	}
+
+	if err := run(ws.Name, "", "select", "0"); err != nil {
+		return target, fmt.Errorf("failed to select binary window: %w", err)
+	}
+
+	return target, nil
+}
+
+func (s Screen) createWindow(ws mux.Workspace) (mux.Target, error) {
+	session := ws.Session
+	if session == "" {
+		session, _ = s.CurrentSession()
+	}
+	if session == "" {
+		return mux.Target{}, fmt.Errorf("not currently in a screen session")
+	}
+
+	target := mux.Target{Name: session + ":" + ws.Name, Window: true}
+	if err := run(session, "", "chdir", ws.Dir); err != nil {
+		return target, err
+	}
+	if err := run(session, "", "screen", "-t", ws.Name); err != nil {
+		return target, fmt.Errorf("failed to create screen window: %w", err)
+	}
+
+	if ws.Command != "" {
+		if err := stuff(session, ws.Name, ws.Command); err != nil {
+			return target, fmt.Errorf("failed to send binary command: %w", err)
+		}
+	}
+
+	if ws.Background {
+		if err := run(session, "", "other"); err != nil {
+			return target, err
+		}
+	}
+
+	return target, nil
+}
+
+func (Screen) SendInput(target mux.Target, text string) error {
+	session, window := split(target)
+	if strings.Contains(text, "\n") {
+		return paste(session, window, text)
+	}
+	return stuff(session, window, text)
+}
+
+func (s Screen) Switch(target mux.Target) error {
+	session, window := split(target)
+	current, _ := s.CurrentSession()
+
+	if current == session {
+		return run(session, "", "select", window)
+	}
+	if current != "" {
+		return fmt.Errorf("screen cannot switch sessions from inside another session, detach and run 'screen -r %s'", session)
+	}
+
+	attachCmd := exec.Command("screen", "-r", session, "-p", window)
+	attachCmd.Stdin = os.Stdin
+	attachCmd.Stdout = os.Stdout
+	attachCmd.Stderr = os.Stderr
+	if err := attachCmd.Run(); err != nil {
+		return fmt.Errorf("failed to attach to screen session: %w", err)
+	}
+	return nil
+}
+
+func (s Screen) Kill(target mux.Target) error {
+	if !s.Alive(target) {
+		return nil // nothing to kill
+	}
+
+	session, window := split(target)
+	if target.Window {
+		return run(session, window, "kill")
+	}
+	return run(session, "", "quit")
+}
+
+func (Screen) Capture(target mux.Target) (string, error) {
+	session, window := split(target)
+
+	f, err := os.CreateTemp("", "treeai-screen-*")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err = run(session, window, "hardcopy", f.Name()); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read screen hardcopy: %w", err)
+	}
+	return string(data), nil
+}
+
+func (s Screen) Alive(target mux.Target) bool {
+	session, window := split(target)
+	sessions, err := s.ListSessions()
+	if err != nil {
+		return false
+	}
+
+	for _, candidate := range sessions {
+		if candidate.Name != session {
+			continue
+		}
+		if !target.Window {
+			return true
+		}
+		queryCmd := exec.Command("screen", "-S", session, "-Q", "windows")
+		output, err := queryCmd.Output()
+		if err != nil {
+			return false
+		}
+		for _, w := range parseWindowList(string(output)) {
+			if w.number == window || w.title == window {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// Message shows text in the session's message line
+func (Screen) Message(target mux.Target, text string) error {
+	session, window := split(target)
+	return run(session, window, "echo", text)
+}
+
+// ListSessions parses `screen -ls`. Screen does not report session directories, so Path is always empty.
+func (Screen) ListSessions() ([]mux.Session, error) {
+	// screen -ls exits non-zero even when it lists sessions
+	output, _ := exec.Command("screen", "-ls").Output()
+	return parseSessionList(string(output)), nil
+}
+
+func parseSessionList(output string) []mux.Session {
+	var sessions []mux.Session
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "\t") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		sessions = append(sessions, mux.Session{Name: sessionFromSTY(fields[0])})
+	}
+	return sessions
+}
+
+// screenWindow is a window listed by `screen -Q windows`
+type screenWindow struct {
+	number string
+	title  string
+}
+
+// parseWindowList parses `screen -Q windows`, which lists windows as `<n><flags> <title>` entries separated by
+// two spaces, e.g. "0$ bash  1*$ feature"
+func parseWindowList(output string) []screenWindow {
+	var windows []screenWindow
+	for _, entry := range strings.Split(strings.TrimSpace(output), "  ") {
+		entry = strings.TrimSpace(entry)
+		head, title, ok := strings.Cut(entry, " ")
+		if !ok {
+			continue
+		}
+		// the number is followed by flags such as * for the current window and $ for a logged in shell
+		end := strings.IndexFunc(head, func(r rune) bool { return r < '0' || r > '9' })
+		if end == -1 {
+			end = len(head)
+		}
+		if end == 0 {
+			continue
+		}
+		windows = append(windows, screenWindow{number: head[:end], title: title})
+	}
+	return windows
+}
+
+// split returns the session and window of a target. Session targets address window 0.
+func split(target mux.Target) (string, string) {
+	if target.Window {
+		if session, window, ok := strings.Cut(target.Name, ":"); ok {
+			return session, window
+		}
+	}
+	return target.Name, "0"
+}
+
+// stuff types text followed by enter into a window
+func stuff(session, window, text string) error {
+	return run(session, window, "stuff", text+"\n")
+}
+
+// paste inserts multi-line text through screen's paste buffer and presses enter, so that the
+// newlines are not typed as separate presses of enter
+func paste(session, window, text string) error {
+	f, err := os.CreateTemp("", "treeai-paste-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(text)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write paste buffer: %w", err)
+	}
+
+	if err = run(session, "", "readbuf", f.Name()); err != nil {
+		return err
+	}
+	if err = run(session, window, "paste", "."); err != nil {
+		return err
+	}
+	return stuff(session, window, "")
+}
+
+// run sends a command to a session, and optionally a specific window within it
+func run(session, window string, command ...string) error {
+	args := []string{"-S", session}
+	if window != "" {
+		args = append(args, "-p", window)
+	}
+	args = append(args, "-X")
+	args = append(args, command...)
+
+	output, err := exec.Command("screen", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("screen %s failed: %w\nOutput: %s", strings.Join(command, " "), err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package screen
+
+import (
+	"testing"
+
+	"github.com/jesses-code-adventures/treeai/mux"
+)
+
+func TestParseSessionList(t *testing.T) {
+	output := "There are screens on:\n" +
+		"\t12345.myproject-feature\t(10/17/2026 09:12:01 AM)\t(Detached)\n" +
+		"\t678.pts-0.host\t(Attached)\n" +
+		"2 Sockets in /run/screen/S-user.\n"
+
+	got := parseSessionList(output)
+	want := []string{"myproject-feature", "pts-0.host"}
+	if len(got) != len(want) {
+		t.Fatalf("parseSessionList() returned %d sessions, want %d: %v", len(got), len(want), got)
+	}
+	for i, session := range got {
+		if session.Name != want[i] {
+			t.Errorf("session %d = %q, want %q", i, session.Name, want[i])
+		}
+	}
+
+	if sessions := parseSessionList("No Sockets found in /run/screen/S-user.\n"); len(sessions) != 0 {
+		t.Errorf("parseSessionList() with no sessions = %v, want none", sessions)
+	}
+}
+
+func TestParseWindowList(t *testing.T) {
+	got := parseWindowList("0$ bash  1-$ feature-x  2*$ my logs  10$ feature\n")
+	want := []screenWindow{{"0", "bash"}, {"1", "feature-x"}, {"2", "my logs"}, {"10", "feature"}}
+	if len(got) != len(want) {
+		t.Fatalf("parseWindowList() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("window %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      mux.Target
+		wantSession string
+		wantWindow  string
+	}{
+		{"session addresses window 0", mux.Target{Name: "proj-feature"}, "proj-feature", "0"},
+		{"window in session", mux.Target{Name: "proj:feature", Window: true}, "proj", "feature"},
+		{"window without session", mux.Target{Name: "feature", Window: true}, "feature", "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session, window := split(tt.target)
+			if session != tt.wantSession || window != tt.wantWindow {
+				t.Errorf("split() = %q, %q, want %q, %q", session, window, tt.wantSession, tt.wantWindow)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package tmux
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jesses-code-adventures/treeai/mux"
+)
+
+// Tmux is the tmux implementation of mux.Multiplexer
+type Tmux struct{}
+
+var _ mux.Multiplexer = Tmux{}
+
+func (Tmux) Name() string {
+	return "tmux"
+}
+
+func (Tmux) CheckInstalled() error {
+	return CheckInstalled()
+}
+
+func (Tmux) CurrentSession() (string, error) {
+	return GetCurrentSession()
+}
+
+func (Tmux) SessionName(gitRoot, worktreeName string) (string, error) {
+	return SessionName(gitRoot, worktreeName)
+}
+
+func (t Tmux) CreateWorkspace(ws mux.Workspace) (mux.Target, error) {
+	if ws.Window {
+		return t.createWindow(ws)
+	}
+	return t.createSession(ws)
+}
+
+func (Tmux) createSession(ws mux.Workspace) (mux.Target, error) {
+	target := mux.Target{Name: ws.Name}
+	if HasSession(ws.Name) {
+		return target, fmt.Errorf("tmux session '%s' already exists", ws.Name)
+	}
+
+	createCmd := exec.Command("tmux", "new-session", "-d", "-s", ws.Name, "-c", ws.Dir)
+	if err := createCmd.Run(); err != nil {
+		return target, fmt.Errorf("failed to create tmux session: %w", err)
+	}
+
+	// Send the binary command to the shell
+	if ws.Command != "" {
+		if err := SendKeys(ws.Name+":0", ws.Command); err != nil {
+			return target, fmt.Errorf("failed to send binary command: %w", err)
+		}
+	}
+
+	// Create additional windows with custom commands
+	for _, command := range ws.Commands {
+		windowCmd := exec.Command("tmux", "new-window", "-t", ws.Name, "-c", ws.Dir, "bash", "-c", command)
+		if err := windowCmd.Run(); err != nil {
+			return target, fmt.Errorf("failed to create window with command '%s': %w", command, err)
+		}
+	}
+
+	// Always select window 0 (the specified binary) as the default focused window
+	selectCmd := exec.Command("tmux", "select-window", "-t", ws.Name+":0")
+	if err := selectCmd.Run(); err != nil {
+		return target, fmt.Errorf("failed to select binary window: %w", err)
+	}
+
+	return target, nil
+}
+
+func (Tmux) createWindow(ws mux.Workspace) (mux.Target, error) {
+	target := mux.Target{Name: ws.Name, Window: true}
+	args := []string{"new-window", "-n", ws.Name, "-c", ws.Dir}
+	if ws.Background {
+		args = append(args, "-d")
+	}
+	if ws.Session != "" {
+		target.Name = ws.Session + ":" + ws.Name
+		args = append(args, "-t", ws.Session+":")
+	}
+
+	createCmd := exec.Command("tmux", args...)
+	if err := createCmd.Run(); err != nil {
+		return target, fmt.Errorf("failed to create tmux window: %w", err)
+	}
+
+	// Send the binary command to the shell in the new window
+	if ws.Command != "" {
+		if err := SendKeys(target.Name, ws.Command); err != nil {
+			return target, fmt.Errorf("failed to send binary command: %w", err)
+		}
+	}
+
+	return target, nil
+}
+
+func (Tmux) SendInput(target mux.Target, text string) error {
+	if strings.Contains(text, "\n") {
+		return PasteText(paneTarget(target), text)
+	}
+	return SendKeys(paneTarget(target), text)
+}
+
+func (Tmux) Switch(target mux.Target) error {
+	if target.Window {
+		id, ok := WindowID(target.Name)
+		if !ok {
+			return fmt.Errorf("tmux window '%s' does not exist", target.Name)
+		}
+		selectCmd := exec.Command("tmux", "select-window", "-t", id)
+		if err := selectCmd.Run(); err != nil {
+			return fmt.Errorf("failed to select tmux window '%s': %w", target.Name, err)
+		}
+		return nil
+	}
+
+	currentSession, err := GetCurrentSession()
+	if err != nil {
+		return err
+	}
+
+	if currentSession != "" {
+		// We're inside tmux, switch to the session
+		return SwitchToSession(target.Name)
+	}
+
+	// We're outside tmux, attach to the session
+	attachCmd := exec.Command("tmux", "attach-session", "-t", exactSession(target.Name))
+	attachCmd.Stdin = os.Stdin
+	attachCmd.Stdout = os.Stdout
+	attachCmd.Stderr = os.Stderr
+	if err := attachCmd.Run(); err != nil {
+		return fmt.Errorf("failed to attach to tmux session: %w", err)
+	}
+	return nil
+}
+
+func (Tmux) Kill(target mux.Target) error {
+	if target.Window {
+		return KillWindow(target.Name)
+	}
+	return KillSession(target.Name)
+}
+
+func (Tmux) Capture(target mux.Target) (string, error) {
+	captureCmd := exec.Command("tmux", "capture-pane", "-p", "-t", paneTarget(target))
+	output, err := captureCmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to capture tmux pane '%s': %w", paneTarget(target), err)
+	}
+	return string(output), nil
+}
+
+func (Tmux) Alive(target mux.Target) bool {
+	if target.Window {
+		return HasWindow(target.Name)
+	}
+	return HasSession(target.Name)
+}
+
+func (Tmux) Message(target mux.Target, text string) error {
+	// display-message expands formats, so # has to be escaped to be shown as-is
+	messageCmd := exec.Command("tmux", "display-message", "-t", exactTarget(target), strings.ReplaceAll(text, "#", "##"))
+	if output, err := messageCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to display tmux message: %w\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+func (Tmux) ListSessions() ([]mux.Session, error) {
+	return ListSessions()
+}
+
+// paneTarget is the pane the agent runs in: window 0 of a session, or the window itself
+func paneTarget(target mux.Target) string {
+	if target.Window {
+		return exactTarget(target)
+	}
+	return exactTarget(target) + ":0"
+}
+
+// exactTarget addresses the session or window named by target and nothing else, since tmux matches bare
+// names by prefix. Windows that no longer exist keep their name, so that tmux reports them as missing.
+func exactTarget(target mux.Target) string {
+	if !target.Window {
+		return exactSession(target.Name)
+	}
+	if id, ok := WindowID(target.Name); ok {
+		return id
+	}
+	return target.Name
+}
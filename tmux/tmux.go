@@ -7,8 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/jesses-code-adventures/treeai/config"
-	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/mux"
 )
 
 func CheckInstalled() error {
@@ -61,150 +60,142 @@ func SessionName(gitRoot, worktreeName string) (string, error) {
 	return fmt.Sprintf("%s-%s", baseSessionName, worktreeName), nil
 }
 
-func CreateAndSwitchSession(cfg *config.Config, worktreeName, prompt string) (string, error) {
-	gitRoot, err := git.FindRoot()
+func SwitchToSession(sessionName string) error {
+	currentSession, err := GetCurrentSession()
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	if cfg == nil {
-		cfg = config.New()
+	if currentSession == "" {
+		return fmt.Errorf("not currently in a tmux session")
 	}
 
-	sessionName, err := SessionName(gitRoot, worktreeName)
-	if err != nil {
-		return "", err
+	if currentSession == sessionName {
+		return nil
 	}
 
-	checkCmd := exec.Command("tmux", "has-session", "-t", sessionName)
-	if checkCmd.Run() == nil {
-		return sessionName, fmt.Errorf("tmux session '%s' already exists", sessionName)
+	if !HasSession(sessionName) {
+		return fmt.Errorf("tmux session '%s' does not exist", sessionName)
 	}
 
-	createCmd := exec.Command("tmux", "new-session", "-d", "-s", sessionName, "-c", cfg.WorktreePath(worktreeName))
-	if err = createCmd.Run(); err != nil {
-		return sessionName, fmt.Errorf("failed to create tmux session: %w", err)
+	switchCmd := exec.Command("tmux", "switch-client", "-t", exactSession(sessionName))
+	if err := switchCmd.Run(); err != nil {
+		return fmt.Errorf("failed to switch to tmux session '%s': %w", sessionName, err)
 	}
 
-	// Send the binary command to the shell
-	sendCmd := exec.Command("tmux", "send-keys", "-t", sessionName+":0", cfg.Bin, "Enter")
-	if err = sendCmd.Run(); err != nil {
-		return sessionName, fmt.Errorf("failed to send binary command: %w", err)
-	}
+	return nil
+}
 
-	// Create additional windows with custom commands
-	for _, command := range cfg.Commands {
-		windowCmd := exec.Command("tmux", "new-window", "-t", sessionName, "-c", cfg.WorktreePath(worktreeName), "bash", "-c", command)
-		if err = windowCmd.Run(); err != nil {
-			return sessionName, fmt.Errorf("failed to create window with command '%s': %w", command, err)
-		}
+func KillSession(sessionName string) error {
+	if !HasSession(sessionName) {
+		return nil // Session doesn't exist, nothing to kill
 	}
 
-	// Always select window 0 (the specified binary) as the default focused window
-	selectCmd := exec.Command("tmux", "select-window", "-t", sessionName+":0")
-	if err = selectCmd.Run(); err != nil {
-		return sessionName, fmt.Errorf("failed to select binary window: %w", err)
+	killCmd := exec.Command("tmux", "kill-session", "-t", exactSession(sessionName))
+	if err := killCmd.Run(); err != nil {
+		return fmt.Errorf("failed to kill tmux session '%s': %w", sessionName, err)
 	}
 
-	// If a prompt is provided, send it to opencode and don't switch/attach to the session
-	if prompt != "" {
-		sendCmd := exec.Command("tmux", "send-keys", "-t", sessionName+":0", prompt, "Enter")
-		if err = sendCmd.Run(); err != nil {
-			return sessionName, fmt.Errorf("failed to send prompt to opencode: %w", err)
-		}
-		return sessionName, nil
-	}
+	return nil
+}
 
-	currentSession, err := GetCurrentSession()
-	if err != nil {
-		return sessionName, err
-	}
+func HasSession(sessionName string) bool {
+	checkCmd := exec.Command("tmux", "has-session", "-t", exactSession(sessionName))
+	return checkCmd.Run() == nil
+}
 
-	if currentSession != "" {
-		// We're inside tmux, switch to the new session
-		switchCmd := exec.Command("tmux", "switch-client", "-t", sessionName)
-		if err := switchCmd.Run(); err != nil {
-			return sessionName, fmt.Errorf("failed to switch to tmux session: %w", err)
-		}
-	} else {
-		// We're outside tmux, attach to the new session
-		attachCmd := exec.Command("tmux", "attach-session", "-t", sessionName)
-		attachCmd.Stdin = os.Stdin
-		attachCmd.Stdout = os.Stdout
-		attachCmd.Stderr = os.Stderr
-		if err := attachCmd.Run(); err != nil {
-			return sessionName, fmt.Errorf("failed to attach to tmux session: %w", err)
-		}
-	}
+// exactSession targets the session with exactly this name. tmux otherwise falls back to matching a bare
+// name as a prefix, so a missing try-1 would resolve to try-10.
+func exactSession(sessionName string) string {
+	return "=" + sessionName
+}
 
-	return sessionName, nil
+// HasWindow reports whether a window exists, either by name in any session or as session:name
+func HasWindow(windowName string) bool {
+	_, ok := WindowID(windowName)
+	return ok
 }
 
-func CreateAndSwitchToWindow(cfg *config.Config, worktreeName, prompt string) (string, error) {
-	if cfg == nil {
-		cfg = config.New()
+// WindowID returns the id of the first window named exactly windowName, either by name in any session or as
+// session:name. Window names given to -t are matched by prefix, so the id is used to target it instead.
+func WindowID(windowName string) (string, bool) {
+	listCmd := exec.Command("tmux", "list-windows", "-a", "-F", "#{session_name}:#{window_name}\t#{window_id}")
+	output, err := listCmd.Output()
+	if err != nil {
+		return "", false
 	}
+	return findWindow(string(output), windowName)
+}
 
-	windowName := worktreeName
-	createCmd := exec.Command("tmux", "new-window", "-n", windowName, "-c", cfg.WorktreePath(worktreeName))
-	if err := createCmd.Run(); err != nil {
-		return windowName, fmt.Errorf("failed to create tmux window: %w", err)
+func findWindow(output, windowName string) (string, bool) {
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		qualified, id, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		_, name, _ := strings.Cut(qualified, ":")
+		if qualified == windowName || name == windowName {
+			return id, true
+		}
 	}
+	return "", false
+}
 
-	// Send the binary command to the shell in the new window
-	sendCmd := exec.Command("tmux", "send-keys", "-t", windowName, cfg.Bin, "Enter")
-	if err := sendCmd.Run(); err != nil {
-		return windowName, fmt.Errorf("failed to send binary command: %w", err)
+func KillWindow(windowName string) error {
+	id, ok := WindowID(windowName)
+	if !ok {
+		return nil // Window doesn't exist, nothing to kill
 	}
 
-	// If a prompt is provided, send it to opencode
-	if prompt != "" {
-		sendCmd := exec.Command("tmux", "send-keys", "-t", windowName, prompt, "Enter")
-		if err := sendCmd.Run(); err != nil {
-			return windowName, fmt.Errorf("failed to send prompt to opencode: %w", err)
-		}
+	killCmd := exec.Command("tmux", "kill-window", "-t", id)
+	if err := killCmd.Run(); err != nil {
+		return fmt.Errorf("failed to kill tmux window '%s': %w", windowName, err)
 	}
 
-	return windowName, nil
+	return nil
 }
 
-func SwitchToSession(sessionName string) error {
-	currentSession, err := GetCurrentSession()
+func ListSessions() ([]mux.Session, error) {
+	listCmd := exec.Command("tmux", "list-sessions", "-F", "#{session_name}:#{session_path}")
+	output, err := listCmd.Output()
 	if err != nil {
-		return err
-	}
-
-	if currentSession == "" {
-		return fmt.Errorf("not currently in a tmux session")
+		return nil, nil // No server running, so no sessions
 	}
 
-	if currentSession == sessionName {
-		return nil
-	}
-
-	checkCmd := exec.Command("tmux", "has-session", "-t", sessionName)
-	if checkCmd.Run() != nil {
-		return fmt.Errorf("tmux session '%s' does not exist", sessionName)
+	var sessions []mux.Session
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		name, path, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		sessions = append(sessions, mux.Session{Name: name, Path: path})
 	}
+	return sessions, nil
+}
 
-	switchCmd := exec.Command("tmux", "switch-client", "-t", sessionName)
-	if err := switchCmd.Run(); err != nil {
-		return fmt.Errorf("failed to switch to tmux session '%s': %w", sessionName, err)
+// SendKeys types text into the target pane and presses enter
+func SendKeys(target, text string) error {
+	sendCmd := exec.Command("tmux", "send-keys", "-t", target, text, "Enter")
+	if err := sendCmd.Run(); err != nil {
+		return fmt.Errorf("failed to send keys to '%s': %w", target, err)
 	}
-
 	return nil
 }
 
-func KillSession(sessionName string) error {
-	checkCmd := exec.Command("tmux", "has-session", "-t", sessionName)
-	if checkCmd.Run() != nil {
-		return nil // Session doesn't exist, nothing to kill
+// PasteText pastes multi-line text into the target pane as a single bracketed paste and presses enter, so
+// that the newlines are not sent as separate presses of enter
+func PasteText(target, text string) error {
+	buffer := "treeai-" + target
+	loadCmd := exec.Command("tmux", "load-buffer", "-b", buffer, "-")
+	loadCmd.Stdin = strings.NewReader(text)
+	if output, err := loadCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to load tmux buffer: %w\nOutput: %s", err, string(output))
 	}
 
-	killCmd := exec.Command("tmux", "kill-session", "-t", sessionName)
-	if err := killCmd.Run(); err != nil {
-		return fmt.Errorf("failed to kill tmux session '%s': %w", sessionName, err)
+	pasteCmd := exec.Command("tmux", "paste-buffer", "-p", "-d", "-b", buffer, "-t", target)
+	if err := pasteCmd.Run(); err != nil {
+		return fmt.Errorf("failed to paste into '%s': %w", target, err)
 	}
 
-	return nil
+	return SendKeys(target, "")
 }
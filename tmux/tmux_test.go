@@ -105,3 +105,24 @@ func TestCheckInstalled(t *testing.T) {
 		t.Log("tmux is installed")
 	}
 }
+
+func TestFindWindow(t *testing.T) {
+	output := "main:x-conflicts\t@1\nmain:try-10\t@2\nother:x\t@3\n"
+	tests := []struct {
+		name   string
+		want   string
+		wantOk bool
+	}{
+		{name: "x", want: "@3", wantOk: true},
+		{name: "main:x", wantOk: false},
+		{name: "other:x", want: "@3", wantOk: true},
+		{name: "try-1", wantOk: false},
+		{name: "x-conflicts", want: "@1", wantOk: true},
+	}
+	for _, tt := range tests {
+		got, ok := findWindow(output, tt.name)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("findWindow(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
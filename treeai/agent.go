@@ -0,0 +1,125 @@
+package treeai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/jesses-code-adventures/treeai/config"
+)
+
+// agentLaunch is the resolved way to start an agent in a tree and hand it the prompt
+type agentLaunch struct {
+	Name    string
+	Command string
+	// PromptVia is how the prompt reaches the agent once Command is running
+	PromptVia string
+	Commands  []string
+}
+
+// agentTemplateData is available to agent command templates. Every field is shell-quoted.
+type agentTemplateData struct {
+	Path       string
+	Branch     string
+	Prompt     string
+	PromptFile string
+}
+
+var (
+	promptField     = regexp.MustCompile(`\.Prompt\b`)
+	promptFileField = regexp.MustCompile(`\.PromptFile\b`)
+)
+
+// prepareAgent resolves the selected agent and renders its command for a new tree, writing the prompt to a
+// file first if the agent reads it from one
+func prepareAgent(cfg *config.Config, repoID, worktreeName, worktreePath, prompt string) (*agentLaunch, error) {
+	name, agent, err := cfg.ResolveAgent()
+	if err != nil {
+		return nil, err
+	}
+
+	via := agent.Prompt
+	if cfg.PromptVia != "" {
+		if err = config.ValidatePromptMethod(cfg.PromptVia); err != nil {
+			return nil, err
+		}
+		via = cfg.PromptVia
+	}
+	// there is no terminal to type into without a multiplexer
+	if cfg.Headless && via == config.PromptSendKeys {
+		via = config.PromptStdin
+	}
+
+	promptFile := ""
+	if prompt != "" && (via == config.PromptFile || (via == config.PromptStdin && !cfg.Headless)) {
+		promptFile = cfg.PromptPath(repoID, worktreeName)
+		if err = writePromptFile(promptFile, prompt); err != nil {
+			return nil, err
+		}
+	}
+
+	command, err := renderAgentCommand(agent.Command, via, cfg.Headless, worktreePath, worktreeName, prompt, promptFile)
+	if err != nil {
+		return nil, fmt.Errorf("agent '%s': %w", name, err)
+	}
+
+	commands := cfg.Commands
+	if len(commands) == 0 {
+		commands = agent.Commands
+	}
+
+	return &agentLaunch{Name: name, Command: command, PromptVia: via, Commands: commands}, nil
+}
+
+// renderAgentCommand renders an agent's command template and attaches the prompt according to via
+func renderAgentCommand(commandTemplate, via string, headless bool, path, branch, prompt, promptFile string) (string, error) {
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(commandTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid command template: %w", err)
+	}
+
+	data := agentTemplateData{Path: shellQuote(path), Branch: shellQuote(branch)}
+	if prompt != "" {
+		data.Prompt = shellQuote(prompt)
+	}
+	if promptFile != "" {
+		data.PromptFile = shellQuote(promptFile)
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render command template: %w", err)
+	}
+	command := b.String()
+
+	if prompt == "" {
+		return command, nil
+	}
+	switch {
+	case via == config.PromptArg && !promptField.MatchString(commandTemplate):
+		command += " " + data.Prompt
+	case via == config.PromptFile && !promptFileField.MatchString(commandTemplate):
+		command += " " + data.PromptFile
+	case via == config.PromptStdin && !headless:
+		command += " < " + data.PromptFile
+	}
+	return command, nil
+}
+
+func writePromptFile(path, prompt string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating prompt directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(prompt+"\n"), 0600); err != nil {
+		return fmt.Errorf("error writing prompt file: %w", err)
+	}
+	return nil
+}
+
+// shellQuote quotes s as a single word for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
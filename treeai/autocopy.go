@@ -0,0 +1,67 @@
+package treeai
+
+import (
+	"fmt"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/copier"
+	"github.com/jesses-code-adventures/treeai/git"
+)
+
+// AutoCopyCandidates lists the files git ignores in the current repository's root, and whether auto-copy
+// would bring each into new trees
+func AutoCopyCandidates(cfg *config.Config) ([]copier.Candidate, error) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	explicit, err := copier.ParseEntries(cfg.Copy)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := shareEntries(cfg)
+	if err != nil {
+		return nil, err
+	}
+	explicit = append(explicit, shared...)
+
+	return autoCopyCandidates(cfg, gitRoot, explicit)
+}
+
+func autoCopyCandidates(cfg *config.Config, gitRoot string, explicit []copier.Entry) ([]copier.Candidate, error) {
+	ignored, err := git.IgnoredFiles(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	if ignored, err = copier.ExpandDirs(gitRoot, ignored); err != nil {
+		return nil, fmt.Errorf("failed to list ignored directories: %w", err)
+	}
+	return copier.Select(ignored, cfg.AutoCopy.Include, cfg.AutoCopy.Exclude, explicit), nil
+}
+
+// autoCopyEntries are the copy entries for the ignored files auto-copy selects, leaving files given
+// with --copy to be brought over as their entries say
+func autoCopyEntries(cfg *config.Config, gitRoot string, explicit []copier.Entry) ([]copier.Entry, error) {
+	mode, err := copier.ParseMode(cfg.AutoCopy.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := autoCopyCandidates(cfg, gitRoot, explicit)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []copier.Entry
+	for _, candidate := range candidates {
+		if candidate.Skip == "" {
+			entries = append(entries, copier.Literal(candidate.Path, mode))
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,187 @@
+package treeai
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+)
+
+// TreeChanges is what a single tree changed since the merge base shared by the compared trees
+type TreeChanges struct {
+	Name   string
+	Branch string
+	// Rev is the branch compared, or the commit a tree with a detached HEAD is on
+	Rev   string
+	Stat  string
+	Files []string
+	// Dirty trees have uncommitted changes that are not part of the comparison
+	Dirty bool
+}
+
+// Comparison is the changes of several sibling trees relative to their shared merge base
+type Comparison struct {
+	MergeBase string
+	Trees     []TreeChanges
+	// Partial are the files changed by some but not all of the trees, sorted
+	Partial []string
+}
+
+// Touched reports which of the compared trees changed file, in the order of Trees
+func (c *Comparison) Touched(file string) []bool {
+	touched := make([]bool, len(c.Trees))
+	for i, tree := range c.Trees {
+		touched[i] = slices.Contains(tree.Files, file)
+	}
+	return touched
+}
+
+// CompareWorktrees compares the branch tips of the named trees against their shared merge base. A name that is
+// not a tree but is the base name of a fan-out selects all of its trees. With no names every tree is compared.
+func CompareWorktrees(cfg *config.Config, names []string) (*Comparison, error) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+
+	statuses, err := selectWorktrees(cfg, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses) < 2 {
+		return nil, fmt.Errorf("need at least two trees to compare")
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	revs := make([]string, len(statuses))
+	for i, s := range statuses {
+		if revs[i], err = treeRev(s); err != nil {
+			return nil, err
+		}
+	}
+	mergeBase, err := git.MergeBase(gitRoot, revs...)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &Comparison{MergeBase: mergeBase}
+	counts := map[string]int{}
+	for i, s := range statuses {
+		changes := TreeChanges{Name: s.Name, Branch: s.Branch, Rev: revs[i], Dirty: s.Dirty}
+		if changes.Files, err = git.ChangedFiles(gitRoot, mergeBase, revs[i]); err != nil {
+			return nil, err
+		}
+		if changes.Stat, err = git.DiffStat(gitRoot, mergeBase, revs[i]); err != nil {
+			return nil, err
+		}
+		for _, file := range changes.Files {
+			counts[file]++
+		}
+		comparison.Trees = append(comparison.Trees, changes)
+	}
+
+	for file, count := range counts {
+		if count < len(statuses) {
+			comparison.Partial = append(comparison.Partial, file)
+		}
+	}
+	sort.Strings(comparison.Partial)
+
+	return comparison, nil
+}
+
+// DiffWorktrees returns the full diff from the branch tip of one tree to another's
+func DiffWorktrees(cfg *config.Config, from, to string) (string, error) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+
+	statuses, err := selectWorktrees(cfg, []string{from, to})
+	if err != nil {
+		return "", err
+	}
+	if len(statuses) != 2 {
+		return "", fmt.Errorf("--diff needs the names of exactly two trees")
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return "", err
+	}
+	fromRev, err := treeRev(statuses[0])
+	if err != nil {
+		return "", err
+	}
+	toRev, err := treeRev(statuses[1])
+	if err != nil {
+		return "", err
+	}
+	return git.Diff(gitRoot, fromRev, toRev)
+}
+
+// treeRev is the tree's branch, or the commit its worktree is on when its HEAD is detached
+func treeRev(s WorktreeStatus) (string, error) {
+	if s.Branch != "" {
+		return s.Branch, nil
+	}
+	rev, err := git.RevParse(s.Path, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("tree '%s' has a detached HEAD that could not be read: %w", s.Name, err)
+	}
+	return rev, nil
+}
+
+// selectWorktrees returns the trees with the given names, in the order given, expanding fan-out base names
+func selectWorktrees(cfg *config.Config, names []string) ([]WorktreeStatus, error) {
+	statuses, err := ListWorktrees(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return statuses, nil
+	}
+
+	var selected []WorktreeStatus
+	for _, name := range names {
+		matches := matchWorktrees(statuses, name)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("worktree '%s' does not exist", name)
+		}
+		for _, match := range matches {
+			if !slices.ContainsFunc(selected, func(s WorktreeStatus) bool { return s.Path == match.Path }) {
+				selected = append(selected, match)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// matchWorktrees returns the tree called name, or failing that the trees of a fan-out with name as its base
+func matchWorktrees(statuses []WorktreeStatus, name string) []WorktreeStatus {
+	for _, s := range statuses {
+		if s.Name == name {
+			return []WorktreeStatus{s}
+		}
+	}
+
+	fanout := regexp.MustCompile("^" + regexp.QuoteMeta(name) + `-([0-9]+)$`)
+	var matches []WorktreeStatus
+	for _, s := range statuses {
+		if fanout.MatchString(s.Name) {
+			matches = append(matches, s)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, _ := strconv.Atoi(fanout.FindStringSubmatch(matches[i].Name)[1])
+		b, _ := strconv.Atoi(fanout.FindStringSubmatch(matches[j].Name)[1])
+		return a < b
+	})
+	return matches
+}
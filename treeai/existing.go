@@ -0,0 +1,67 @@
+package treeai
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+)
+
+// checkNewBranch makes sure a tree's branch can be created, pointing at --checkout-existing if it already exists
+func checkNewBranch(gitRoot, branch string) error {
+	if git.BranchExists(gitRoot, branch) {
+		return fmt.Errorf("branch '%s' already exists, use --checkout-existing to open a tree on it", branch)
+	}
+	return nil
+}
+
+// existingBranch finds the branch a tree opened with --checkout-existing attaches to. A local branch is used
+// as is, unless another worktree already has it checked out. Otherwise the remote-tracking branch to create it
+// from is returned, fetching the branch from each remote if it hasn't been fetched yet.
+func existingBranch(cfg *config.Config, gitRoot, branch string) (string, error) {
+	if git.BranchExists(gitRoot, branch) {
+		return "", checkNotCheckedOut(cfg, gitRoot, branch)
+	}
+
+	remotes, err := git.Remotes(gitRoot)
+	if err != nil {
+		return "", err
+	}
+	// prefer origin when several remotes have the branch
+	if i := slices.Index(remotes, "origin"); i > 0 {
+		remotes = append([]string{"origin"}, slices.Delete(remotes, i, i+1)...)
+	}
+
+	for _, remote := range remotes {
+		if git.RemoteBranchExists(gitRoot, remote+"/"+branch) {
+			return remote + "/" + branch, nil
+		}
+	}
+	for _, remote := range remotes {
+		if err = git.FetchBranch(gitRoot, remote, branch); err == nil {
+			return remote + "/" + branch, nil
+		}
+	}
+
+	return "", fmt.Errorf("branch '%s' does not exist locally or on any remote", branch)
+}
+
+// checkNotCheckedOut reports which worktree has branch checked out, since git only allows it in one at a time
+func checkNotCheckedOut(cfg *config.Config, gitRoot, branch string) error {
+	worktrees, err := git.ListWorktrees(gitRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, wt := range worktrees {
+		if wt.Branch != branch {
+			continue
+		}
+		if tree, ok := lookupWorktree(cfg, wt.Path); ok {
+			return fmt.Errorf("branch '%s' is already checked out in tree '%s' at %s", branch, tree.Name, wt.Path)
+		}
+		return fmt.Errorf("branch '%s' is already checked out at %s", branch, wt.Path)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package treeai
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/logger"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+// FanoutResult is the outcome of creating one tree of a fan-out
+type FanoutResult struct {
+	Name  string
+	Agent string
+	Tree  *registry.Tree
+	Err   error
+}
+
+// Fanout creates count trees named <baseName>-1 to <baseName>-N concurrently, without switching to any of them.
+// Each tree is given the prompt returned for its name, so templates can refer to the tree's own branch; a nil
+// prompt gives none. Agents are assigned to the trees in turn; with none given the configured agent is used.
+func Fanout(cfg *config.Config, baseName string, count int, agents []string, prompt func(name string) (string, error)) ([]FanoutResult, error) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+	logger.Init(cfg)
+
+	if count < 1 {
+		return nil, fmt.Errorf("count must be at least 1")
+	}
+	if len(agents) > 0 && cfg.Bin != "" {
+		return nil, fmt.Errorf("--agent and --bin cannot be used together")
+	}
+
+	// check every agent and prompt up front, rather than failing part way through
+	configs := make([]*config.Config, count)
+	prompts := make([]string, count)
+	for i := range configs {
+		treeCfg := *cfg
+		if len(agents) > 0 {
+			treeCfg.Agent = agents[i%len(agents)]
+		}
+		if _, _, err := treeCfg.ResolveAgent(); err != nil {
+			return nil, err
+		}
+		configs[i] = &treeCfg
+
+		if prompt != nil {
+			var err error
+			if prompts[i], err = prompt(fanoutName(baseName, i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// fetch a pull request ref once, rather than from every tree at the same time
+	if cfg.From != "" {
+		gitRoot, err := git.FindRoot()
+		if err != nil {
+			return nil, err
+		}
+		if err = checkFrom(gitRoot, cfg.From); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]FanoutResult, count)
+	var wg sync.WaitGroup
+	for i, treeCfg := range configs {
+		results[i] = FanoutResult{Name: fanoutName(baseName, i), Agent: treeCfg.Agent}
+		if treeCfg.Bin != "" {
+			results[i].Agent = treeCfg.Bin
+		}
+
+		wg.Add(1)
+		go func(result *FanoutResult, treeCfg *config.Config, prompt string) {
+			defer wg.Done()
+			result.Tree, result.Err = createTree(treeCfg, result.Name, prompt, false)
+		}(&results[i], treeCfg, prompts[i])
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// fanoutName is the name of the i-th tree of a fan-out, counting from 0
+func fanoutName(baseName string, i int) string {
+	return fmt.Sprintf("%s-%d", baseName, i+1)
+}
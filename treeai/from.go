@@ -0,0 +1,55 @@
+package treeai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+)
+
+// fetchedRefPrefixes are refs forges publish that aren't fetched by default, so are fetched from origin on demand
+var fetchedRefPrefixes = []string{"refs/pull/", "refs/merge-requests/"}
+
+// checkFrom makes sure the ref a new tree starts from exists, fetching pull and merge request refs from origin
+func checkFrom(gitRoot, from string) error {
+	if _, err := git.ResolveCommit(gitRoot, from); err == nil {
+		return nil
+	}
+
+	for _, prefix := range fetchedRefPrefixes {
+		if strings.HasPrefix(from, prefix) {
+			if err := git.FetchRef(gitRoot, "origin", from); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	_, err := git.ResolveCommit(gitRoot, from)
+	return err
+}
+
+// treeBase returns the branch a new tree is merged back into: --base if given, the branch it starts from
+// if that is a local branch or a remote-tracking branch with a local counterpart, and otherwise the root's
+// current branch
+func treeBase(cfg *config.Config, gitRoot string) (string, error) {
+	if cfg.Base != "" {
+		if !git.BranchExists(gitRoot, cfg.Base) {
+			return "", fmt.Errorf("base branch '%s' does not exist", cfg.Base)
+		}
+		return cfg.Base, nil
+	}
+
+	if cfg.From != "" {
+		if branch := strings.TrimPrefix(cfg.From, "refs/heads/"); git.BranchExists(gitRoot, branch) {
+			return branch, nil
+		}
+		remoteBranch := strings.TrimPrefix(cfg.From, "refs/remotes/")
+		if _, branch, ok := strings.Cut(remoteBranch, "/"); ok && git.RemoteBranchExists(gitRoot, remoteBranch) && git.BranchExists(gitRoot, branch) {
+			return branch, nil
+		}
+	}
+
+	return git.GetCurrentBranch(gitRoot)
+}
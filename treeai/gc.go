@@ -0,0 +1,259 @@
+package treeai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/logger"
+	"github.com/jesses-code-adventures/treeai/mux"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+// Debris is a single inconsistency between git, the data directory, the registry and the multiplexer
+type Debris struct {
+	Kind        string
+	Description string
+	Fix         func() error
+}
+
+// GarbageCollect prunes git's worktree list, then reports and fixes every piece of debris left behind by failed operations
+func GarbageCollect(cfg *config.Config, yes bool) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+	logger.Init(cfg)
+	l := logger.Logger
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	l.Info("Pruning git worktrees\n")
+	if err = git.PruneWorktrees(gitRoot); err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	debris, err := FindDebris(cfg, gitRoot)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	if len(debris) == 0 {
+		fmt.Println("Nothing to clean up")
+		return
+	}
+
+	failed := 0
+	for _, d := range debris {
+		fmt.Printf("%s: %s\n", d.Kind, d.Description)
+		if !yes && !confirm("Fix?") {
+			continue
+		}
+		if err = d.Fix(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		exitWithError("Error: failed to fix %d of %d issue(s)\n", failed, len(debris))
+	}
+}
+
+// FindDebris cross-references git's worktrees, the data directory, the registry and multiplexer sessions for a repository
+func FindDebris(cfg *config.Config, gitRoot string) ([]Debris, error) {
+	commonDir, err := git.CommonDir(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	repoID, err := git.RepoID(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	worktrees, err := git.ListWorktrees(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, wt := range worktrees {
+		if !wt.Prunable {
+			known[filepath.Clean(wt.Path)] = true
+		}
+	}
+
+	reg, err := registry.Load(cfg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var debris []Debris
+
+	orphans, err := orphanedDirectories(cfg.RepoDir(repoID), cfg.Data, commonDir, known)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range orphans {
+		debris = append(debris, Debris{
+			Kind:        "directory",
+			Description: fmt.Sprintf("%s is not a worktree git knows about", dir),
+			Fix: func() error {
+				logger.Logger.Info(fmt.Sprintf("Removing directory: %s\n", dir))
+				return os.RemoveAll(dir)
+			},
+		})
+	}
+
+	for _, tree := range reg.ForRepo(repoID) {
+		if (known[tree.Path] || known[resolvePath(tree.Path)]) && dirExists(tree.Path) {
+			continue
+		}
+
+		if !tree.ExistingBranch && git.BranchExists(gitRoot, tree.Branch) {
+			debris = append(debris, Debris{
+				Kind:        "branch",
+				Description: fmt.Sprintf("branch %s has no worktree", tree.Branch),
+				Fix: func() error {
+					logger.Logger.Info(fmt.Sprintf("Deleting branch: %s\n", tree.Branch))
+					if err := git.ForceDeleteBranch(gitRoot, tree.Branch); err != nil {
+						return err
+					}
+					return forgetWorktree(cfg, tree.Path)
+				},
+			})
+			continue
+		}
+
+		description := fmt.Sprintf("tree %s is recorded but its worktree and branch are gone", tree.Name)
+		if tree.ExistingBranch {
+			description = fmt.Sprintf("tree %s is recorded but its worktree is gone (branch %s existed before it and is kept)", tree.Name, tree.Branch)
+		}
+		debris = append(debris, Debris{
+			Kind:        "registry",
+			Description: description,
+			Fix: func() error {
+				return forgetWorktree(cfg, tree.Path)
+			},
+		})
+	}
+
+	m, err := newMultiplexer(cfg.Multiplexer)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := m.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		path := sessionPath(reg, m.Name(), session)
+		if !insideDataDir(cfg, path) || dirExists(path) {
+			continue
+		}
+		debris = append(debris, Debris{
+			Kind:        "session",
+			Description: fmt.Sprintf("%s session %s points at missing directory %s", m.Name(), session.Name, path),
+			Fix: func() error {
+				logger.Logger.Info(fmt.Sprintf("Killing %s session: %s\n", m.Name(), session.Name))
+				return m.Kill(mux.Target{Name: session.Name})
+			},
+		})
+	}
+
+	return debris, nil
+}
+
+// sessionPath is the directory a session was opened in. Multiplexers that don't report it, like screen, fall
+// back to the path of the tree recorded with that session.
+func sessionPath(reg *registry.Registry, multiplexer string, session mux.Session) string {
+	if session.Path != "" {
+		return session.Path
+	}
+	for _, tree := range reg.Trees {
+		if tree.Multiplexer == multiplexer && tree.Session == session.Name {
+			return tree.Path
+		}
+	}
+	return ""
+}
+
+// orphanedDirectories returns directories in the repository's data directory, or legacy flat-layout
+// directories that point back at this repository, which are not worktrees git knows about
+func orphanedDirectories(repoDir, dataDir, commonDir string, known map[string]bool) ([]string, error) {
+	var orphans []string
+
+	repoEntries, err := readDirs(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range repoEntries {
+		if known[path] || known[resolvePath(path)] {
+			continue
+		}
+		if gitDir, err := git.WorktreeGitDir(path); err == nil && dirExists(gitDir) && !isWithin(commonDir, gitDir) {
+			continue // a live worktree of another repository
+		}
+		orphans = append(orphans, path)
+	}
+
+	legacyEntries, err := readDirs(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range legacyEntries {
+		if known[path] || known[resolvePath(path)] {
+			continue
+		}
+		if gitDir, err := git.WorktreeGitDir(path); err == nil && isWithin(commonDir, gitDir) {
+			orphans = append(orphans, path)
+		}
+	}
+
+	return orphans, nil
+}
+
+func readDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading data directory: %w", err)
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+func insideDataDir(cfg *config.Config, path string) bool {
+	_, ok := relativeName(cfg.Data, path)
+	return ok
+}
+
+func isWithin(parent, path string) bool {
+	rel, err := filepath.Rel(parent, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
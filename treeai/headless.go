@@ -0,0 +1,162 @@
+package treeai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/logger"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+// startHeadless launches a detached supervisor that runs the tree's agent in the background and records how it exits
+func startHeadless(cfg *config.Config, tree *registry.Tree, promptVia string) (*registry.Process, error) {
+	logPath := cfg.LogPath(tree.RepoID, tree.Name)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, fmt.Errorf("error creating log directory: %w", err)
+	}
+
+	process := &registry.Process{Log: logPath, PromptVia: promptVia, StartedAt: time.Now()}
+	tree.Headless = process
+	if err := registry.Update(cfg.Data, func(r *registry.Registry) error {
+		r.Put(tree)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record headless agent: %w", err)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the treeai executable: %w", err)
+	}
+
+	// The supervisor gets its own session so it outlives this process and any terminal it was started from
+	supervisor := exec.Command(exe, "supervise", tree.Path, "--data", cfg.Data, "--silent")
+	supervisor.Dir = tree.Path
+	supervisor.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err = supervisor.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start headless supervisor: %w", err)
+	}
+	process.Supervisor = supervisor.Process.Pid
+
+	return process, supervisor.Process.Release()
+}
+
+// Supervise runs the agent of a headless tree in the foreground, writing its output to the tree's log and
+// recording its PID and exit status in the registry. It is run in a detached process by startHeadless.
+func Supervise(cfg *config.Config, worktreePath string) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+	logger.Init(cfg)
+
+	tree, ok := lookupWorktree(cfg, worktreePath)
+	if !ok || tree.Headless == nil {
+		exitWithError("Error: no headless agent is recorded for %s\n", worktreePath)
+	}
+	process := tree.Headless
+
+	logFile, err := os.OpenFile(process.Log, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		exitWithError("Error opening log: %v\n", err)
+	}
+	defer logFile.Close()
+
+	agent := headlessCommand(tree.Bin, tree.Prompt, process.PromptVia)
+	agent.Dir = tree.Path
+	agent.Stdout = logFile
+	agent.Stderr = logFile
+	// A process group of its own lets the agent and everything it spawns be stopped together
+	agent.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	fmt.Fprintf(logFile, "treeai: starting %q in %s at %s\n", tree.Bin, tree.Path, time.Now().Format(time.RFC3339))
+	if err = agent.Start(); err != nil {
+		fmt.Fprintf(logFile, "treeai: failed to start agent: %v\n", err)
+		recordExit(cfg, worktreePath, -1)
+		os.Exit(1)
+	}
+
+	if err = updateProcess(cfg, worktreePath, func(p *registry.Process) {
+		p.PID = agent.Process.Pid
+		p.Supervisor = os.Getpid()
+	}); err != nil {
+		fmt.Fprintf(logFile, "treeai: failed to record agent pid: %v\n", err)
+	}
+
+	exitCode := 0
+	if err = agent.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintf(logFile, "treeai: failed waiting for agent: %v\n", err)
+		}
+		exitCode = exitStatus(agent.ProcessState)
+	}
+	fmt.Fprintf(logFile, "treeai: agent exited with status %d at %s\n", exitCode, time.Now().Format(time.RFC3339))
+
+	recordExit(cfg, worktreePath, exitCode)
+}
+
+// headlessCommand runs the rendered agent command through the shell, feeding it the prompt on stdin when asked to
+func headlessCommand(command, prompt, promptVia string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", command)
+	if promptVia == config.PromptStdin && prompt != "" {
+		cmd.Stdin = strings.NewReader(prompt + "\n")
+	}
+	return cmd
+}
+
+// exitStatus follows the shell convention of 128 plus the signal number for agents killed by a signal
+func exitStatus(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+func recordExit(cfg *config.Config, worktreePath string, exitCode int) {
+	exitedAt := time.Now()
+	if err := updateProcess(cfg, worktreePath, func(p *registry.Process) {
+		p.ExitCode = &exitCode
+		p.ExitedAt = &exitedAt
+	}); err != nil {
+		logger.Logger.Warn(fmt.Sprintf("Warning: failed to record agent exit: %v\n", err))
+	}
+}
+
+// updateProcess modifies the recorded headless process of a tree, doing nothing if the tree has since been removed
+func updateProcess(cfg *config.Config, worktreePath string, fn func(*registry.Process)) error {
+	return registry.Update(cfg.Data, func(r *registry.Registry) error {
+		if tree, ok := r.Get(worktreePath); ok && tree.Headless != nil {
+			fn(tree.Headless)
+		}
+		return nil
+	})
+}
+
+// processAlive reports whether a recorded headless agent is still running
+func processAlive(p *registry.Process) bool {
+	if !p.Running() || p.PID == 0 {
+		return false
+	}
+	err := syscall.Kill(p.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// stopHeadless terminates a running headless agent and everything it started
+func stopHeadless(p *registry.Process) error {
+	if !processAlive(p) {
+		return nil
+	}
+
+	logger.Logger.Info(fmt.Sprintf("Stopping headless agent: pid %d\n", p.PID))
+	if err := syscall.Kill(-p.PID, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("could not stop headless agent %d: %w", p.PID, err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package treeai
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/jesses-code-adventures/treeai/logger"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+// Hook points, given to hooks as TREEAI_HOOK
+const (
+	hookPreCreate  = "pre-create"
+	hookPostCreate = "post-create"
+	hookPreMerge   = "pre-merge"
+	hookPostMerge  = "post-merge"
+	hookPreDiscard = "pre-discard"
+)
+
+// runHooks runs each of a hook point's commands through the shell in dir, stopping at the first that fails
+func runHooks(hook string, commands []string, dir string, tree *registry.Tree) error {
+	l := logger.Logger
+
+	for _, command := range commands {
+		l.Info(fmt.Sprintf("Running %s hook: %s\n", hook, command))
+
+		hookCmd := exec.Command("sh", "-c", command)
+		hookCmd.Dir = dir
+		hookCmd.Env = append(os.Environ(), treeEnv(tree)...)
+		hookCmd.Env = append(hookCmd.Env, "TREEAI_HOOK="+hook)
+		output, err := hookCmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s hook '%s' failed: %w\nOutput: %s", hook, command, err, output)
+		}
+		l.Debug(fmt.Sprintf("%s hook output: %s", hook, output))
+	}
+	return nil
+}
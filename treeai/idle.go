@@ -0,0 +1,198 @@
+package treeai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/logger"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+// Activity states of a running agent
+const (
+	// ActivityWorking is an agent whose output is still changing
+	ActivityWorking = "working"
+	// ActivityIdle is an agent waiting for input, either showing one of its ready patterns or with output
+	// unchanged for the configured idle_after
+	ActivityIdle = "idle"
+)
+
+// logTail is how much of a headless agent's log is matched against its ready patterns
+const logTail = 4096
+
+// WaitForIdle blocks until a tree's agent is idle or no longer running, polling every interval, and returns its
+// final state, notifying the user of it when asked to. It fails once timeout has elapsed, unless timeout is zero.
+func WaitForIdle(cfg *config.Config, worktreeName string, timeout, interval time.Duration, notify bool) (string, error) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return "", err
+	}
+
+	worktreePath, err := findWorktreePath(cfg, gitRoot, worktreeName)
+	if err != nil {
+		return "", err
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	for {
+		tree, ok := lookupWorktree(cfg, worktreePath)
+		if !ok {
+			return "", fmt.Errorf("'%s' is not in the registry, so its agent can't be watched", worktreeName)
+		}
+
+		state, err := waitState(cfg, gitRoot, worktreeName, tree)
+		if err != nil {
+			return "", err
+		}
+		if state != ActivityWorking {
+			if notify {
+				if err = notifyTree(cfg, tree, state); err != nil {
+					logger.Logger.Warn(fmt.Sprintf("Warning: %v\n", err))
+				}
+			}
+			return state, nil
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out after %s waiting for '%s' to go idle", timeout, worktreeName)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// waitState is idle or working for a running agent, and otherwise how it stopped
+func waitState(cfg *config.Config, gitRoot, worktreeName string, tree *registry.Tree) (string, error) {
+	if _, alive := sessionState(cfg, gitRoot, worktreeName, tree); !alive {
+		if tree.Headless != nil && tree.Headless.ExitCode != nil {
+			return fmt.Sprintf("exited %d", *tree.Headless.ExitCode), nil
+		}
+		return "stopped", nil
+	}
+	return observeActivity(cfg, tree)
+}
+
+// observeActivity judges whether a running agent is idle from its output. The output of agents in a multiplexer
+// is recorded in the registry, so that it staying the same can be noticed across commands.
+func observeActivity(cfg *config.Config, tree *registry.Tree) (string, error) {
+	output, changedAt, err := agentOutput(cfg, tree)
+	if err != nil {
+		return "", err
+	}
+
+	if matchesReady(readyPatterns(cfg, tree.Agent), output) {
+		return ActivityIdle, nil
+	}
+
+	// Headless logs carry their own modification time, pane contents have to be compared with the last seen
+	if changedAt.IsZero() {
+		sum := sha256.Sum256([]byte(output))
+		hash := hex.EncodeToString(sum[:])
+		if tree.Activity != nil && tree.Activity.Hash == hash {
+			changedAt = tree.Activity.ChangedAt
+		} else {
+			changedAt = time.Now()
+			if err = recordActivity(cfg, tree.Path, &registry.Activity{Hash: hash, ChangedAt: changedAt}); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if time.Since(changedAt) >= cfg.IdleAfter {
+		return ActivityIdle, nil
+	}
+	return ActivityWorking, nil
+}
+
+// agentOutput returns the latest output of a tree's agent, and when it last changed if that is known
+func agentOutput(cfg *config.Config, tree *registry.Tree) (string, time.Time, error) {
+	if tree.Headless != nil {
+		return readLogTail(tree.Headless.Log)
+	}
+
+	m, err := multiplexerFor(cfg, tree)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	output, err := m.Capture(treeTarget(tree))
+	return output, time.Time{}, err
+}
+
+func readLogTail(path string) (string, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to open agent log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read agent log: %w", err)
+	}
+	if info.Size() > logTail {
+		if _, err = f.Seek(-logTail, io.SeekEnd); err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to read agent log: %w", err)
+		}
+	}
+
+	tail, err := io.ReadAll(f)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read agent log: %w", err)
+	}
+	return string(tail), info.ModTime(), nil
+}
+
+// readyPatterns compiles the ready patterns of an agent profile. Trees launched with --bin have none.
+func readyPatterns(cfg *config.Config, agentName string) []*regexp.Regexp {
+	agent, err := cfg.AgentProfile(agentName)
+	if err != nil {
+		return nil
+	}
+
+	var patterns []*regexp.Regexp
+	for _, pattern := range agent.Ready {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Logger.Warn(fmt.Sprintf("Warning: ignoring invalid ready pattern %q for agent '%s': %v\n", pattern, agentName, err))
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns
+}
+
+// matchesReady reports whether the output, ignoring trailing blank lines, matches any of the patterns
+func matchesReady(patterns []*regexp.Regexp, output string) bool {
+	output = strings.TrimRight(output, " \t\r\n")
+	for _, re := range patterns {
+		if re.MatchString(output) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordActivity stores the last seen output of a tree's agent, doing nothing if the tree has since been removed
+func recordActivity(cfg *config.Config, worktreePath string, activity *registry.Activity) error {
+	return registry.Update(cfg.Data, func(r *registry.Registry) error {
+		if tree, ok := r.Get(worktreePath); ok {
+			tree.Activity = activity
+		}
+		return nil
+	})
+}
@@ -0,0 +1,206 @@
+package treeai
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/logger"
+	"github.com/jesses-code-adventures/treeai/mux"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+// WorktreeStatus is a snapshot of a single tree's live state
+type WorktreeStatus struct {
+	Name    string
+	Branch  string
+	Path    string
+	Base    string
+	Ahead   int
+	Behind  int
+	Dirty   bool
+	Session string
+	Alive   bool
+	// Headless trees run their agent as a background process rather than in a session
+	Headless bool
+	// ExitCode is set once a headless agent has exited
+	ExitCode *int
+	// Log is where a headless agent's output is written
+	Log string
+	// LastCommit is when the commit at the tip of the tree's branch was made
+	LastCommit time.Time
+	// Activity is whether a running agent is idle or working, if its output could be read
+	Activity string
+	// ExistingBranch trees were opened on a branch that existed before them, which removing them keeps
+	ExistingBranch bool
+	Err            error
+}
+
+// AgentState describes whether the tree's agent is still running
+func (s WorktreeStatus) AgentState() string {
+	switch {
+	case s.Headless && s.ExitCode != nil:
+		return fmt.Sprintf("exited %d", *s.ExitCode)
+	case s.Alive && s.Activity != "":
+		return s.Activity
+	case s.Alive:
+		return "running"
+	case s.Headless:
+		return "lost"
+	case s.Session != "":
+		return "stopped"
+	default:
+		return "-"
+	}
+}
+
+// ListWorktrees returns the state of every worktree in the data directory belonging to the current repository
+func ListWorktrees(cfg *config.Config) ([]WorktreeStatus, error) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := git.GetCurrentBranch(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	repoID, err := git.RepoID(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	worktrees, err := git.ListWorktrees(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := registry.Load(cfg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []WorktreeStatus
+	for _, wt := range worktrees {
+		name, ok := treeName(cfg, repoID, wt.Path)
+		if !ok {
+			continue
+		}
+		tree, _ := reg.Get(wt.Path)
+		statuses = append(statuses, worktreeStatus(cfg, gitRoot, base, name, wt, tree))
+	}
+
+	return statuses, nil
+}
+
+func worktreeStatus(cfg *config.Config, gitRoot, base, name string, wt git.Worktree, tree *registry.Tree) WorktreeStatus {
+	if tree != nil && tree.Base != "" {
+		base = tree.Base
+	}
+
+	status := WorktreeStatus{
+		Name:   name,
+		Branch: wt.Branch,
+		Path:   wt.Path,
+		Base:   base,
+	}
+
+	if wt.Prunable {
+		status.Err = fmt.Errorf("worktree directory is missing")
+		return status
+	}
+
+	if wt.Branch != "" && base != "" {
+		status.Ahead, status.Behind, status.Err = git.AheadBehind(gitRoot, base, wt.Branch)
+	}
+
+	dirty, err := git.HasUncommittedChanges(wt.Path)
+	if err != nil && status.Err == nil {
+		status.Err = err
+	}
+	status.Dirty = dirty
+
+	if wt.Branch != "" {
+		if status.LastCommit, err = git.CommitTime(gitRoot, wt.Branch); err != nil && status.Err == nil {
+			status.Err = err
+		}
+	}
+
+	status.Session, status.Alive = sessionState(cfg, gitRoot, name, tree)
+	status.ExistingBranch = tree != nil && tree.ExistingBranch
+	if tree != nil && tree.Headless != nil {
+		status.Headless = true
+		status.ExitCode = tree.Headless.ExitCode
+		status.Log = tree.Headless.Log
+	}
+	if status.Alive && tree != nil {
+		if status.Activity, err = observeActivity(cfg, tree); err != nil {
+			logger.Logger.Debug(fmt.Sprintf("Could not read agent output for %s: %v\n", name, err))
+		}
+	}
+
+	return status
+}
+
+// treeName returns the worktree name for a path inside the repository's data directory,
+// or directly inside the data directory for trees created with the legacy flat layout
+func treeName(cfg *config.Config, repoID, path string) (string, bool) {
+	if name, ok := relativeName(cfg.RepoDir(repoID), path); ok {
+		return name, true
+	}
+	if name, ok := relativeName(cfg.Data, path); ok && !strings.ContainsRune(name, filepath.Separator) {
+		return name, true
+	}
+	return "", false
+}
+
+func relativeName(dir, path string) (string, bool) {
+	for _, candidate := range pathCandidates(dir) {
+		rel, err := filepath.Rel(candidate, path)
+		if err != nil || rel == "." || !isWithin(candidate, path) {
+			continue
+		}
+		return rel, true
+	}
+	return "", false
+}
+
+func pathCandidates(path string) []string {
+	candidates := []string{filepath.Clean(path)}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil && resolved != candidates[0] {
+		candidates = append(candidates, resolved)
+	}
+	return candidates
+}
+
+// sessionState returns the session, window or headless agent for a tree and whether it is still alive
+func sessionState(cfg *config.Config, gitRoot, name string, tree *registry.Tree) (string, bool) {
+	if tree != nil && tree.Headless != nil {
+		return fmt.Sprintf("pid %d", tree.Headless.PID), processAlive(tree.Headless)
+	}
+
+	m, err := multiplexerFor(cfg, tree)
+	if err != nil {
+		return "", false
+	}
+
+	if tree != nil && tree.Session != "" {
+		return tree.Session, m.Alive(treeTarget(tree))
+	}
+
+	if sessionName, err := m.SessionName(gitRoot, name); err == nil && m.Alive(mux.Target{Name: sessionName}) {
+		return sessionName, true
+	}
+	if m.Alive(mux.Target{Name: name, Window: true}) {
+		return name, true
+	}
+	return "", false
+}
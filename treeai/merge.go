@@ -0,0 +1,514 @@
+package treeai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/logger"
+	"github.com/jesses-code-adventures/treeai/mux"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+const (
+	// mergeStepSync brings the base branch into the tree, so conflicts are resolved inside the tree
+	mergeStepSync = "sync"
+	// mergeStepMerge brings the tree's branch into the base branch in the git root
+	mergeStepMerge = "merge"
+)
+
+// mergeTarget is everything needed to merge a tree, resolved from the registry where possible
+type mergeTarget struct {
+	cfg          *config.Config
+	gitRoot      string
+	worktreePath string
+	worktreeName string
+	tree         *registry.Tree
+	recorded     bool
+}
+
+func resolveMergeTarget(cfg *config.Config, worktreeName string) *mergeTarget {
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	worktreePath, err := findWorktreePath(cfg, gitRoot, worktreeName)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	tree, recorded := lookupWorktree(cfg, worktreePath)
+	if recorded {
+		gitRoot = tree.Repo
+	} else {
+		tree = &registry.Tree{Name: worktreeName, Path: worktreePath, Repo: gitRoot, Branch: worktreeName}
+	}
+
+	return &mergeTarget{
+		cfg:          cfg,
+		gitRoot:      gitRoot,
+		worktreePath: worktreePath,
+		worktreeName: worktreeName,
+		tree:         tree,
+		recorded:     recorded,
+	}
+}
+
+// MergeWorktree merges a tree into its base branch, or into when it is set, and cleans it up. The git root is
+// only switched to that branch when into names it. If conflicts stop the merge it is paused in a recorded state
+// and can be resumed with ContinueMerge or rolled back with AbortMerge.
+func MergeWorktree(cfg *config.Config, worktreeName, into string, resolveWithAgent bool) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+	logger.Init(cfg)
+	l := logger.Logger
+
+	t := resolveMergeTarget(cfg, worktreeName)
+	if t.tree.Merge != nil {
+		exitWithError("Error: a merge of '%s' is already in progress. Use --continue or --abort\n", worktreeName)
+	}
+
+	strategy, err := ParseStrategy(cfg.Strategy)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	if err = validateMergePrerequisites(t.gitRoot, t.worktreePath, worktreeName); err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	currentBranch, err := git.GetCurrentBranch(t.gitRoot)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	targetBranch := t.targetBranch(currentBranch)
+	if into != "" {
+		targetBranch = into
+	} else if targetBranch != currentBranch {
+		exitWithError("Error: '%s' merges into '%s' but %s is on '%s'. Switch it to '%s' first, or pass --into %s\n", worktreeName, targetBranch, t.gitRoot, currentBranch, targetBranch, targetBranch)
+	}
+
+	if err = runHooks(hookPreMerge, cfg.Hooks.PreMerge, t.worktreePath, t.hookTree(targetBranch)); err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	report, err := git.CheckConflicts(t.gitRoot, targetBranch, t.tree.Branch)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+	if report.HasConflicts() {
+		printConflictReport(report)
+	}
+
+	if targetBranch != currentBranch {
+		l.Info(fmt.Sprintf("Switching %s to %s...\n", t.gitRoot, targetBranch))
+		if err = git.SwitchBranch(t.gitRoot, targetBranch); err != nil {
+			exitWithError("Error: %v\n", err)
+		}
+	}
+
+	state := &registry.Merge{
+		Strategy:       string(strategy),
+		Target:         targetBranch,
+		OrigRootBranch: currentBranch,
+		StartedAt:      time.Now(),
+	}
+	if state.OrigRootHead, err = git.RevParse(t.gitRoot, "HEAD"); err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+	if state.OrigTreeHead, err = git.RevParse(t.worktreePath, "HEAD"); err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	t.runMerge(state, mergeStepSync, resolveWithAgent)
+}
+
+// CheckMerge reports the paths that would conflict when merging a tree into its base branch, without touching anything
+func CheckMerge(cfg *config.Config, worktreeName string) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+	logger.Init(cfg)
+
+	t := resolveMergeTarget(cfg, worktreeName)
+
+	currentBranch, err := git.GetCurrentBranch(t.gitRoot)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+	targetBranch := t.targetBranch(currentBranch)
+
+	report, err := git.CheckConflicts(t.gitRoot, targetBranch, t.tree.Branch)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	if report.HasConflicts() {
+		printConflictReport(report)
+		os.Exit(1)
+	}
+	fmt.Printf("%s merges cleanly into %s\n", report.Branch, report.Target)
+}
+
+// ContinueMerge resumes a paused merge from the step where it stopped
+func ContinueMerge(cfg *config.Config, worktreeName string, resolveWithAgent bool) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+	logger.Init(cfg)
+
+	t := resolveMergeTarget(cfg, worktreeName)
+	state := t.tree.Merge
+	if state == nil {
+		exitWithError("Error: no merge of '%s' is in progress\n", worktreeName)
+	}
+
+	strategy, err := ParseStrategy(state.Strategy)
+	if err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	switch state.Step {
+	case mergeStepSync:
+		if err = finishOperation(t.worktreePath, strategy, ""); err != nil {
+			t.pauseOrExit(state, mergeStepSync, err, resolveWithAgent)
+		}
+		t.runMerge(state, mergeStepMerge, resolveWithAgent)
+	case mergeStepMerge:
+		message := ""
+		if strategy == StrategySquash {
+			if message, err = squashMessage(t.gitRoot, t.tree.Branch, state.OrigRootHead); err != nil {
+				exitWithError("Error: %v\n", err)
+			}
+		}
+		if err = finishOperation(t.gitRoot, strategy, message); err != nil {
+			t.pauseOrExit(state, mergeStepMerge, err, resolveWithAgent)
+		}
+		t.cleanup(strategy, state)
+	default:
+		exitWithError("Error: unknown merge step '%s'\n", state.Step)
+	}
+}
+
+// AbortMerge rolls a paused merge back to the state before the merge started
+func AbortMerge(cfg *config.Config, worktreeName string) {
+	if cfg == nil {
+		cfg = config.New()
+	}
+	logger.Init(cfg)
+	l := logger.Logger
+
+	t := resolveMergeTarget(cfg, worktreeName)
+	state := t.tree.Merge
+	if state == nil {
+		exitWithError("Error: no merge of '%s' is in progress\n", worktreeName)
+	}
+
+	l.Info(fmt.Sprintf("Restoring %s to %s\n", t.worktreePath, state.OrigTreeHead))
+	if err := abortOperation(t.worktreePath, state.OrigTreeHead); err != nil {
+		exitWithError("Error: %v\n", err)
+	}
+
+	if state.Step == mergeStepMerge {
+		l.Info(fmt.Sprintf("Restoring %s to %s\n", t.gitRoot, state.OrigRootHead))
+		if err := abortOperation(t.gitRoot, state.OrigRootHead); err != nil {
+			exitWithError("Error: %v\n", err)
+		}
+	}
+
+	if currentBranch, err := git.GetCurrentBranch(t.gitRoot); err == nil && state.OrigRootBranch != "" && currentBranch != state.OrigRootBranch {
+		l.Info(fmt.Sprintf("Switching %s back to %s\n", t.gitRoot, state.OrigRootBranch))
+		if err = git.SwitchBranch(t.gitRoot, state.OrigRootBranch); err != nil {
+			exitWithError("Error: %v\n", err)
+		}
+	}
+
+	t.closeConflictWindow(state)
+	t.tree.Merge = nil
+	if err := t.save(); err != nil {
+		exitWithError("Error: failed to update registry: %v\n", err)
+	}
+
+	l.Info(fmt.Sprintf("Aborted merge of %s\n", worktreeName))
+}
+
+// targetBranch is the branch the tree was created from, or the git root's current branch if that was not recorded
+func (t *mergeTarget) targetBranch(currentBranch string) string {
+	if t.tree.Base != "" {
+		return t.tree.Base
+	}
+	return currentBranch
+}
+
+// hookTree describes the tree to merge hooks, with the branch it is merged into as its base
+func (t *mergeTarget) hookTree(target string) *registry.Tree {
+	tree := *t.tree
+	tree.Base = target
+	return &tree
+}
+
+func printConflictReport(report *git.ConflictReport) {
+	fmt.Fprintf(os.Stderr, "Merging %s into %s will conflict in %d file(s):\n", report.Branch, report.Target, len(report.Conflicts))
+	for _, conflict := range report.Conflicts {
+		if len(conflict.Types) == 0 {
+			fmt.Fprintf(os.Stderr, "  %s\n", conflict.Path)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %s (%s)\n", conflict.Path, strings.Join(conflict.Types, ", "))
+	}
+}
+
+// runMerge runs the merge from the given step onwards, pausing if a step stops on conflicts
+func (t *mergeTarget) runMerge(state *registry.Merge, step string, resolveWithAgent bool) {
+	l := logger.Logger
+	strategy := MergeStrategy(state.Strategy)
+
+	if step == mergeStepSync {
+		var err error
+		if strategy.rebases() {
+			l.Info(fmt.Sprintf("Rebasing on %s...\n", state.Target))
+			err = git.RebaseOnBranch(t.worktreePath, state.Target)
+		} else {
+			l.Info(fmt.Sprintf("Merging %s into %s...\n", state.Target, t.tree.Branch))
+			err = git.MergeInto(t.worktreePath, state.Target)
+		}
+		if err != nil {
+			t.pauseOrExit(state, mergeStepSync, err, resolveWithAgent)
+		}
+	}
+
+	l.Info(fmt.Sprintf("Merging branch %s with strategy %s\n", t.tree.Branch, strategy))
+	if err := strategy.mergeBranch(t.gitRoot, t.tree.Branch, state.Target); err != nil {
+		t.pauseOrExit(state, mergeStepMerge, err, resolveWithAgent)
+	}
+
+	t.cleanup(strategy, state)
+}
+
+// cleanup removes the merged tree's worktree, registry entry and session or window, and its branch unless the
+// branch existed before the tree
+func (t *mergeTarget) cleanup(strategy MergeStrategy, state *registry.Merge) {
+	l := logger.Logger
+
+	l.Info(fmt.Sprintf("Removing worktree: %s\n", t.worktreePath))
+	if err := git.RemoveWorktree(t.gitRoot, t.worktreePath); err != nil {
+		exitWithError("Error removing worktree: %v\n", err)
+	}
+
+	if t.tree.ExistingBranch {
+		l.Info(fmt.Sprintf("Keeping branch %s, which existed before the tree\n", t.tree.Branch))
+	} else {
+		l.Info(fmt.Sprintf("Deleting branch: %s\n", t.tree.Branch))
+		deleteBranch := git.DeleteBranch
+		if strategy.rewritesCommits() {
+			deleteBranch = git.ForceDeleteBranch
+		}
+		if err := deleteBranch(t.gitRoot, t.tree.Branch); err != nil {
+			exitWithError("Error deleting branch %s: %v\n", t.tree.Branch, err)
+		}
+	}
+
+	if err := forgetWorktree(t.cfg, t.worktreePath); err != nil {
+		l.Warn(fmt.Sprintf("Warning: failed to update registry: %v\n", err))
+	}
+
+	if err := runHooks(hookPostMerge, t.cfg.Hooks.PostMerge, t.gitRoot, t.hookTree(state.Target)); err != nil {
+		l.Warn(fmt.Sprintf("Warning: %v\n", err))
+	}
+
+	t.closeConflictWindow(state)
+
+	if err := killWorktreeSession(t.cfg, t.gitRoot, t.worktreeName, t.tree); err != nil {
+		l.Error(fmt.Sprintf("Warning: %v\n", err))
+		return
+	}
+
+	l.Info(fmt.Sprintf("Successfully merged and cleaned up worktree: %s\n", t.worktreeName))
+}
+
+// pauseOrExit records a merge that stopped on conflicts and exits, or exits with the error if it was not a conflict
+func (t *mergeTarget) pauseOrExit(state *registry.Merge, step string, err error, resolveWithAgent bool) {
+	var conflictErr *git.ConflictError
+	if !errors.As(err, &conflictErr) {
+		exitWithError("Error: %v\n", err)
+	}
+
+	t.closeConflictWindow(state)
+	state.Step = step
+	state.Conflicts = conflictErr.Files
+	state.ConflictWindow = t.openConflictWindow(conflictErr.Dir)
+	t.tree.Merge = state
+	if err = t.save(); err != nil {
+		exitWithError("Error: failed to record paused merge: %v\n", err)
+	}
+
+	if resolveWithAgent && step == mergeStepSync {
+		if err = t.handToAgent(conflictErr); err != nil {
+			logger.Logger.Warn(fmt.Sprintf("Warning: %v\n", err))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Merge of '%s' paused: %s stopped with conflicts in %s:\n", t.worktreeName, conflictErr.Operation, conflictErr.Dir)
+	for _, file := range conflictErr.Files {
+		fmt.Fprintf(os.Stderr, "  %s\n", file)
+	}
+	exitWithError("Resolve and stage them, then run 'treeai merge %s --continue', or 'treeai merge %s --abort' to restore the pre-merge state\n", t.worktreeName, t.worktreeName)
+}
+
+// openConflictWindow opens a window in dir listing the conflicted files, returning its target
+func (t *mergeTarget) openConflictWindow(dir string) string {
+	m, err := multiplexerFor(t.cfg, t.tree)
+	if err != nil {
+		return ""
+	}
+
+	sessionName := ""
+	if t.recorded && !t.tree.Window && m.Alive(treeTarget(t.tree)) {
+		sessionName = t.tree.Session
+	} else if current, err := m.CurrentSession(); err != nil || current == "" {
+		return ""
+	}
+
+	command := fmt.Sprintf(`echo "Conflicts while merging %s:"; git diff --name-only --diff-filter=U; echo; echo "Resolve and stage them, then run: treeai merge %s --continue"`, t.worktreeName, t.worktreeName)
+	target, err := m.CreateWorkspace(mux.Workspace{
+		Name:       t.worktreeName + "-conflicts",
+		Dir:        dir,
+		Command:    command,
+		Window:     true,
+		Session:    sessionName,
+		Background: true,
+	})
+	if err != nil {
+		logger.Logger.Warn(fmt.Sprintf("Warning: %v\n", err))
+		return ""
+	}
+	return target.Name
+}
+
+// handToAgent asks the agent running in the tree to resolve the conflicts
+func (t *mergeTarget) handToAgent(conflictErr *git.ConflictError) error {
+	if !t.recorded || t.tree.Session == "" {
+		return fmt.Errorf("no agent session recorded for '%s'", t.worktreeName)
+	}
+
+	finish := "git rebase --continue"
+	if conflictErr.Operation == "merge" {
+		finish = "git commit --no-edit"
+	}
+	prompt := fmt.Sprintf("A %s onto %s stopped with conflicts in: %s. Resolve the conflicts, stage the files and run `%s`. Do not make any other changes.",
+		conflictErr.Operation, t.tree.Merge.Target, strings.Join(conflictErr.Files, ", "), finish)
+	m, err := multiplexerFor(t.cfg, t.tree)
+	if err != nil {
+		return err
+	}
+	return m.SendInput(treeTarget(t.tree), prompt)
+}
+
+func (t *mergeTarget) save() error {
+	return registry.Update(t.cfg.Data, func(r *registry.Registry) error {
+		r.Put(t.tree)
+		return nil
+	})
+}
+
+// finishOperation concludes whatever rebase, merge or cherry-pick is stopped in dir once its conflicts are resolved
+func finishOperation(dir string, strategy MergeStrategy, squashMessage string) error {
+	files, err := git.ConflictedFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		return &git.ConflictError{Dir: dir, Operation: operationInProgress(dir), Files: files}
+	}
+
+	switch {
+	case git.RebaseInProgress(dir):
+		return git.RebaseContinue(dir)
+	case git.CherryPickInProgress(dir):
+		return git.CherryPickContinue(dir)
+	case git.MergeInProgress(dir):
+		return git.CommitMerge(dir)
+	case strategy == StrategySquash && squashMessage != "" && git.HasStagedChanges(dir):
+		return git.Commit(dir, squashMessage)
+	}
+	return nil
+}
+
+func operationInProgress(dir string) string {
+	switch {
+	case git.RebaseInProgress(dir):
+		return "rebase"
+	case git.CherryPickInProgress(dir):
+		return "cherry-pick"
+	default:
+		return "merge"
+	}
+}
+
+// abortOperation aborts whatever rebase, merge or cherry-pick is stopped in dir and resets it to head
+func abortOperation(dir, head string) error {
+	switch {
+	case git.RebaseInProgress(dir):
+		if err := git.RebaseAbort(dir); err != nil {
+			return err
+		}
+	case git.CherryPickInProgress(dir):
+		if err := git.CherryPickAbort(dir); err != nil {
+			return err
+		}
+	case git.MergeInProgress(dir):
+		if err := git.MergeAbort(dir); err != nil {
+			return err
+		}
+	}
+
+	if current, err := git.RevParse(dir, "HEAD"); err == nil && current == head && !git.HasStagedChanges(dir) {
+		return nil
+	}
+	return git.ResetHard(dir, head)
+}
+
+func (t *mergeTarget) closeConflictWindow(state *registry.Merge) {
+	if state == nil || state.ConflictWindow == "" {
+		return
+	}
+	m, err := multiplexerFor(t.cfg, t.tree)
+	if err != nil {
+		return
+	}
+	if err = m.Kill(mux.Target{Name: state.ConflictWindow, Window: true}); err != nil {
+		logger.Logger.Debug(fmt.Sprintf("conflict window already closed: %v", err))
+	}
+	state.ConflictWindow = ""
+}
+
+func validateMergePrerequisites(gitRoot, worktreePath, worktreeName string) error {
+	hasChanges, err := git.HasUncommittedChanges(gitRoot)
+	if err != nil {
+		return fmt.Errorf("checking git status in root: %w", err)
+	}
+	if hasChanges {
+		return fmt.Errorf("uncommitted changes in git root. Please commit or stash changes first")
+	}
+
+	if _, err = os.Stat(worktreePath); os.IsNotExist(err) {
+		return fmt.Errorf("worktree '%s' does not exist", worktreeName)
+	}
+
+	hasChanges, err = git.HasUncommittedChanges(worktreePath)
+	if err != nil {
+		return fmt.Errorf("checking git status in worktree: %w", err)
+	}
+	if hasChanges {
+		return fmt.Errorf("uncommitted changes in worktree '%s'. Please commit or stash changes first", worktreeName)
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package treeai
+
+import (
+	"fmt"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/mux"
+	"github.com/jesses-code-adventures/treeai/registry"
+	"github.com/jesses-code-adventures/treeai/screen"
+	"github.com/jesses-code-adventures/treeai/tmux"
+)
+
+func newMultiplexer(name string) (mux.Multiplexer, error) {
+	switch name {
+	case "", "tmux":
+		return tmux.Tmux{}, nil
+	case "screen":
+		return screen.Screen{}, nil
+	default:
+		return nil, fmt.Errorf("unknown multiplexer '%s', expected tmux or screen", name)
+	}
+}
+
+// multiplexerFor returns the multiplexer a tree was opened in, falling back to the configured one for unrecorded trees
+func multiplexerFor(cfg *config.Config, tree *registry.Tree) (mux.Multiplexer, error) {
+	if tree != nil && tree.Multiplexer != "" {
+		return newMultiplexer(tree.Multiplexer)
+	}
+	return newMultiplexer(cfg.Multiplexer)
+}
+
+// treeTarget is the session or window a recorded tree's agent runs in
+func treeTarget(tree *registry.Tree) mux.Target {
+	return mux.Target{Name: tree.Session, Window: tree.Window}
+}
@@ -0,0 +1,135 @@
+package treeai
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/mux"
+	"github.com/jesses-code-adventures/treeai/registry"
+)
+
+// Notify tells the user with every configured notifier that the agent of the tree at worktreePath is now in state
+func Notify(cfg *config.Config, worktreePath, state string) error {
+	tree, ok := lookupWorktree(cfg, worktreePath)
+	if !ok {
+		return fmt.Errorf("no tree is recorded at %s", worktreePath)
+	}
+	return notifyTree(cfg, tree, state)
+}
+
+func notifyTree(cfg *config.Config, tree *registry.Tree, state string) error {
+	if err := cfg.ValidateNotifiers(); err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("treeai: %s %s", tree.Name, describeState(state))
+	var errs []error
+	for _, notifier := range cfg.Notify {
+		var err error
+		switch notifier {
+		case config.NotifyMessage:
+			err = notifyMessage(cfg, tree, summary)
+		case config.NotifyBell:
+			err = ringBell()
+		case config.NotifyDesktop:
+			err = notifyDesktop(tree, summary)
+		case config.NotifyCommand:
+			err = runNotifyCommand(cfg, tree, state)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s notifier: %w", notifier, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func describeState(state string) string {
+	switch {
+	case state == ActivityIdle:
+		return "is waiting for input"
+	case strings.HasPrefix(state, "exited "):
+		return "exited with status " + strings.TrimPrefix(state, "exited ")
+	case state == "stopped":
+		return "has stopped"
+	default:
+		return "is " + state
+	}
+}
+
+// notifyMessage shows the summary in the session the tree was created from, if it was created inside a multiplexer
+func notifyMessage(cfg *config.Config, tree *registry.Tree, summary string) error {
+	if tree.OriginSession == "" {
+		return nil
+	}
+
+	m, err := multiplexerFor(cfg, tree)
+	if err != nil {
+		return err
+	}
+	return m.Message(mux.Target{Name: tree.OriginSession}, summary)
+}
+
+func ringBell() error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("no terminal to ring: %w", err)
+	}
+	defer tty.Close()
+
+	_, err = tty.WriteString("\a")
+	return err
+}
+
+func notifyDesktop(tree *registry.Tree, summary string) error {
+	notifyCmd := exec.Command("notify-send", "--app-name", "treeai", summary, tree.Path)
+	if output, err := notifyCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run notify-send: %w\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+// runNotifyCommand runs notify_command in the tree, with the tree and its state in the environment
+func runNotifyCommand(cfg *config.Config, tree *registry.Tree, state string) error {
+	notifyCmd := exec.Command("sh", "-c", cfg.NotifyCommand)
+	notifyCmd.Dir = tree.Path
+	notifyCmd.Env = append(os.Environ(), treeEnv(tree)...)
+	notifyCmd.Env = append(notifyCmd.Env, "TREEAI_STATUS="+state)
+	if output, err := notifyCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to run notify command: %w\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+// treeEnv describes a tree to commands treeai runs for it
+func treeEnv(tree *registry.Tree) []string {
+	return []string{
+		"TREEAI_NAME=" + tree.Name,
+		"TREEAI_BRANCH=" + tree.Branch,
+		"TREEAI_PATH=" + tree.Path,
+		"TREEAI_BASE=" + tree.Base,
+		"TREEAI_GIT_ROOT=" + tree.Repo,
+	}
+}
+
+// watchForIdle starts a background treeai wait that notifies once the new tree's agent goes idle or stops
+func watchForIdle(cfg *config.Config, tree *registry.Tree) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the treeai executable: %w", err)
+	}
+
+	watcher := exec.Command(exe, "wait", tree.Name, "--notify", "--data", cfg.Data, "--silent")
+	watcher.Dir = tree.Repo
+	// A process group of its own keeps the watcher clear of the shell's job control, while keeping
+	// the terminal so the bell notifier can still ring it
+	watcher.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = watcher.Start(); err != nil {
+		return fmt.Errorf("failed to start watching for idle: %w", err)
+	}
+	return watcher.Process.Release()
+}
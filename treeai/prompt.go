@@ -0,0 +1,67 @@
+package treeai
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/prompt"
+)
+
+// templateFields are provided to every prompt template and cannot be set with --var
+var templateFields = []string{"Branch", "Repo", "Base", "Prompt"}
+
+// RenderPromptTemplate renders the named prompt template from config for a new tree. The prompt given on the
+// command line is available to it as .Prompt, and each --var as a field of its own.
+func RenderPromptTemplate(cfg *config.Config, templateName, worktreeName, userPrompt string, vars map[string]string) (string, error) {
+	text, ok := cfg.Templates[templateName]
+	if !ok {
+		names := make([]string, 0, len(cfg.Templates))
+		for name := range cfg.Templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return "", fmt.Errorf("unknown template '%s', no templates are defined in config.toml", templateName)
+		}
+		return "", fmt.Errorf("unknown template '%s', expected one of: %s", templateName, strings.Join(names, ", "))
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return "", err
+	}
+	repo, err := git.RepoName(gitRoot)
+	if err != nil {
+		return "", err
+	}
+	base, err := treeBase(cfg, gitRoot)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := templateData(worktreeName, repo, base, userPrompt, vars)
+	if err != nil {
+		return "", err
+	}
+	return prompt.Render(templateName, text, data)
+}
+
+func templateData(branch, repo, base, userPrompt string, vars map[string]string) (map[string]any, error) {
+	data := map[string]any{
+		"Branch": branch,
+		"Repo":   repo,
+		"Base":   base,
+		"Prompt": userPrompt,
+	}
+	for key, value := range vars {
+		if slices.Contains(templateFields, key) {
+			return nil, fmt.Errorf("--var %s is set by treeai and cannot be overridden", key)
+		}
+		data[key] = value
+	}
+	return data, nil
+}
@@ -0,0 +1,37 @@
+package treeai
+
+import (
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/copier"
+	"github.com/jesses-code-adventures/treeai/git"
+)
+
+func shareEntries(cfg *config.Config) ([]copier.Entry, error) {
+	entries := make([]copier.Entry, 0, len(cfg.Share))
+	for _, s := range cfg.Share {
+		entry, err := copier.ParseShare(s)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// ignoreLinks keeps symlinks placed in a tree out of git status. Patterns like node_modules/ only match
+// directories, not symlinks to them, so links git doesn't already ignore are added to info/exclude.
+func ignoreLinks(gitRoot, worktreePath string, links []string) error {
+	var patterns []string
+	for _, link := range links {
+		if !git.IsIgnored(worktreePath, link) {
+			patterns = append(patterns, "/"+link)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	worktreeAddMu.Lock()
+	defer worktreeAddMu.Unlock()
+	return git.Exclude(gitRoot, patterns)
+}
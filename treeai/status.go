@@ -0,0 +1,51 @@
+package treeai
+
+import (
+	"fmt"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/mux"
+)
+
+// SwitchToWorktree focuses the session or window a tree's agent runs in, attaching to it when outside the multiplexer
+func SwitchToWorktree(cfg *config.Config, worktreeName string) error {
+	if cfg == nil {
+		cfg = config.New()
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		return err
+	}
+
+	worktreePath, err := findWorktreePath(cfg, gitRoot, worktreeName)
+	if err != nil {
+		return err
+	}
+
+	tree, recorded := lookupWorktree(cfg, worktreePath)
+	if recorded && tree.Headless != nil {
+		return fmt.Errorf("'%s' runs headless, its output is in %s", worktreeName, tree.Headless.Log)
+	}
+
+	m, err := multiplexerFor(cfg, tree)
+	if err != nil {
+		return err
+	}
+
+	target := mux.Target{}
+	if recorded {
+		target = treeTarget(tree)
+	}
+	if target.Name == "" {
+		if target.Name, err = m.SessionName(gitRoot, worktreeName); err != nil {
+			return err
+		}
+	}
+
+	if !m.Alive(target) {
+		return fmt.Errorf("the %s session for '%s' is no longer running", m.Name(), worktreeName)
+	}
+	return m.Switch(target)
+}
@@ -0,0 +1,93 @@
+package treeai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jesses-code-adventures/treeai/git"
+)
+
+// MergeStrategy controls how a tree's branch is brought into its base branch
+type MergeStrategy string
+
+const (
+	// StrategyRebaseFF rebases the tree onto the base branch and fast-forwards the base branch
+	StrategyRebaseFF MergeStrategy = "rebase-ff"
+	// StrategySquash rebases the tree onto the base branch and commits its changes as a single commit
+	StrategySquash MergeStrategy = "squash"
+	// StrategyNoFF merges the base branch into the tree, then merges the tree's branch into the base branch with a
+	// merge commit, keeping the tree's commits unchanged
+	StrategyNoFF MergeStrategy = "no-ff"
+	// StrategyCherryPick rebases the tree onto the base branch and cherry-picks its commits
+	StrategyCherryPick MergeStrategy = "cherry-pick"
+)
+
+var strategies = []MergeStrategy{StrategyRebaseFF, StrategySquash, StrategyNoFF, StrategyCherryPick}
+
+func ParseStrategy(s string) (MergeStrategy, error) {
+	if s == "" {
+		return StrategyRebaseFF, nil
+	}
+	for _, strategy := range strategies {
+		if MergeStrategy(s) == strategy {
+			return strategy, nil
+		}
+	}
+
+	names := make([]string, len(strategies))
+	for i, strategy := range strategies {
+		names[i] = string(strategy)
+	}
+	return "", fmt.Errorf("unknown merge strategy '%s', expected one of: %s", s, strings.Join(names, ", "))
+}
+
+// rebases reports whether the strategy rebases the tree onto the base branch before merging
+func (s MergeStrategy) rebases() bool {
+	return s != StrategyNoFF
+}
+
+// rewritesCommits reports whether the strategy lands different commits than the ones on the tree's branch,
+// in which case git cannot tell that the branch was merged and it must be force deleted
+func (s MergeStrategy) rewritesCommits() bool {
+	return s == StrategySquash || s == StrategyCherryPick
+}
+
+// mergeBranch brings branchName into the current branch of gitRoot, which must already be the target branch
+func (s MergeStrategy) mergeBranch(gitRoot, branchName, targetBranch string) error {
+	switch s {
+	case StrategySquash:
+		message, err := squashMessage(gitRoot, branchName, targetBranch)
+		if err != nil {
+			return err
+		}
+		return git.SquashMerge(gitRoot, branchName, message)
+	case StrategyNoFF:
+		return git.MergeBranchNoFF(gitRoot, branchName)
+	case StrategyCherryPick:
+		return git.CherryPick(gitRoot, branchName)
+	default:
+		return git.MergeBranch(gitRoot, branchName)
+	}
+}
+
+// squashMessage reuses the message of a single commit, or lists the subjects of every squashed commit
+func squashMessage(gitRoot, branchName, targetBranch string) (string, error) {
+	subjects, err := git.CommitSubjects(gitRoot, targetBranch, branchName)
+	if err != nil {
+		return "", err
+	}
+
+	if len(subjects) == 1 {
+		return subjects[0] + "\n", nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Squash merge branch '%s'\n", branchName)
+	if len(subjects) > 0 {
+		b.WriteString("\n")
+	}
+	for _, subject := range subjects {
+		fmt.Fprintf(&b, "* %s\n", subject)
+	}
+	return b.String(), nil
+}
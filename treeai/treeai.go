@@ -1,125 +1,347 @@
 package treeai
 
 import (
+	"bufio"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/copier"
 	"github.com/jesses-code-adventures/treeai/git"
 	"github.com/jesses-code-adventures/treeai/logger"
-	"github.com/jesses-code-adventures/treeai/tmux"
+	"github.com/jesses-code-adventures/treeai/mux"
+	"github.com/jesses-code-adventures/treeai/registry"
 )
 
+// osExit ends the process after an error. Tests replace it to observe commands that exit.
+var osExit = os.Exit
+
 func exitWithError(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, format, args...)
-	os.Exit(1)
+	osExit(1)
 }
 
-func CopyFile(srcPath, dstPath string) error {
-	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-		return fmt.Errorf("error creating directory: %v", err)
-	}
-
-	srcFile, err := os.Open(srcPath)
-	if err != nil {
-		return fmt.Errorf("error opening source file: %v", err)
-	}
-	defer srcFile.Close()
-
-	dstFile, err := os.Create(dstPath)
-	if err != nil {
-		return fmt.Errorf("error creating destination file: %v", err)
-	}
-	defer dstFile.Close()
-
-	if _, err := io.Copy(dstFile, srcFile); err != nil {
-		return fmt.Errorf("error copying file: %v", err)
+// confirm asks a yes/no question on stdin, treating anything but an explicit yes as no. Tests replace it to
+// answer in place of the user.
+var confirm = func(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return false
 	}
-	return nil
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
+// worktreeAddMu serialises the steps of creating a tree that write to the shared git directory
+var worktreeAddMu sync.Mutex
+
 func CreateWorktree(cfg *config.Config, worktreeName, prompt string) {
 	if cfg == nil {
 		cfg = config.New()
 	}
 	logger.Init(cfg)
-	l := logger.Logger
-	if err := tmux.CheckInstalled(); err != nil {
+
+	if _, err := createTree(cfg, worktreeName, prompt, true); err != nil {
 		exitWithError("Error: %v\n", err)
 	}
+}
+
+// createTree creates a worktree and starts its agent. With attach, a new session is switched to when
+// there is no prompt for the agent to get started on; otherwise focus is left where it is.
+func createTree(cfg *config.Config, worktreeName, prompt string, attach bool) (*registry.Tree, error) {
+	l := logger.Logger
+
+	// headless trees run without a multiplexer, so it doesn't need to be installed
+	var m mux.Multiplexer
+	var err error
+	if !cfg.Headless {
+		if m, err = newMultiplexer(cfg.Multiplexer); err == nil {
+			err = m.CheckInstalled()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err = cfg.ResolveAgent(); err != nil {
+		return nil, err
+	}
+	if cfg.NotifyIdle {
+		if err = cfg.ValidateNotifiers(); err != nil {
+			return nil, err
+		}
+	}
+	copyEntries, err := copier.ParseEntries(cfg.Copy)
+	if err != nil {
+		return nil, err
+	}
+	sharedEntries, err := shareEntries(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	gitRoot, err := git.FindRoot()
 	if err != nil {
-		exitWithError("Error: %v\n", err)
+		return nil, err
 	}
 	l.Debug(fmt.Sprintf("gitRoot: %s", gitRoot))
 
-	worktreePath, err := setupWorktreeDirectory(cfg, worktreeName)
+	worktreePath, err := setupWorktreeDirectory(cfg, gitRoot, worktreeName)
 	if err != nil {
-		exitWithError("Error: %v\n", err)
+		return nil, err
 	}
 	l.Debug(fmt.Sprintf("worktreePath: %s", worktreePath))
 
-	if err = git.CreateWorktree(gitRoot, worktreePath, worktreeName); err != nil {
-		exitWithError("Error creating git worktree: %v\n", err)
+	var upstream string
+	if cfg.CheckoutExisting {
+		if upstream, err = existingBranch(cfg, gitRoot, worktreeName); err != nil {
+			return nil, err
+		}
+	} else if err = checkNewBranch(gitRoot, worktreeName); err != nil {
+		return nil, err
+	}
+	if cfg.From != "" {
+		if err = checkFrom(gitRoot, cfg.From); err != nil {
+			return nil, err
+		}
+	}
+	base, err := treeBase(cfg, gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	pending := &registry.Tree{Name: worktreeName, Path: worktreePath, Repo: gitRoot, Branch: worktreeName, Base: base}
+	if err = runHooks(hookPreCreate, cfg.Hooks.PreCreate, gitRoot, pending); err != nil {
+		return nil, err
 	}
 
-	if len(cfg.Copy) > 0 {
-		for _, file := range cfg.Copy {
-			srcPath := filepath.Join(gitRoot, file)
-			dstPath := filepath.Join(worktreePath, file)
-			if _, err = os.Stat(srcPath); os.IsNotExist(err) {
-				continue
-			}
-			if err = CopyFile(srcPath, dstPath); err != nil {
-				exitWithError("Error copying file: %v\n", err)
-			}
+	// after the pre-create hooks, which may generate ignored files themselves
+	if cfg.AutoCopy.Enabled {
+		autoEntries, err := autoCopyEntries(cfg, gitRoot, append(copyEntries, sharedEntries...))
+		if err != nil {
+			return nil, fmt.Errorf("finding ignored files to copy: %w", err)
 		}
+		copyEntries = append(autoEntries, copyEntries...)
+	}
+
+	worktreeAddMu.Lock()
+	if cfg.CheckoutExisting {
+		err = git.CheckoutWorktree(gitRoot, worktreePath, worktreeName, upstream)
+	} else {
+		err = git.CreateWorktreeFrom(gitRoot, worktreePath, worktreeName, cfg.From)
+	}
+	worktreeAddMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("creating git worktree: %w", err)
+	}
+
+	copied, err := copier.Apply(gitRoot, worktreePath, copyEntries)
+	if err != nil {
+		return nil, fmt.Errorf("copying files: %w", err)
+	}
+	for _, missing := range copied.Missing {
+		l.Warn(fmt.Sprintf("Warning: nothing in %s matches --copy %s\n", gitRoot, missing))
+	}
+
+	shared, err := copier.Apply(gitRoot, worktreePath, sharedEntries)
+	if err != nil {
+		return nil, fmt.Errorf("sharing paths: %w", err)
+	}
+	for _, missing := range shared.Missing {
+		l.Warn(fmt.Sprintf("Warning: nothing in %s matches share entry %s\n", gitRoot, missing))
+	}
+
+	if err = ignoreLinks(gitRoot, worktreePath, append(copied.Links, shared.Links...)); err != nil {
+		l.Warn(fmt.Sprintf("Warning: failed to exclude linked paths from git: %v\n", err))
 	}
 
 	// TODO: might not need this if using data dir
-	if err = git.UpdateIgnore(gitRoot, cfg.Gitignore); err != nil {
+	worktreeAddMu.Lock()
+	err = git.UpdateIgnore(gitRoot, cfg.Gitignore)
+	worktreeAddMu.Unlock()
+	if err != nil {
 		l.Warn(fmt.Sprintf("Warning: failed to update .gitignore: %v\n", err))
 	}
 
-	if cfg.Bin == "opencode" {
-		cfg.Bin = cfg.Bin + " " + worktreePath
+	repoID, err := git.RepoID(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	agent, err := prepareAgent(cfg, repoID, worktreeName, worktreePath, prompt)
+	if err != nil {
+		return nil, err
 	}
 
-	if cfg.Window {
-		s, err := tmux.CreateAndSwitchToWindow(cfg, worktreeName, prompt)
+	tree, err := recordWorktree(cfg, m, agent, gitRoot, worktreePath, worktreeName, base, prompt)
+	if err != nil {
+		l.Warn(fmt.Sprintf("Warning: failed to record worktree in registry: %v\n", err))
+	}
+
+	if err = runHooks(hookPostCreate, cfg.Hooks.PostCreate, worktreePath, tree); err != nil {
+		l.Warn(fmt.Sprintf("Warning: %v\n", err))
+	}
+
+	if cfg.Headless {
+		process, err := startHeadless(cfg, tree, agent.PromptVia)
 		if err != nil {
-			exitWithError("Error creating tmux window: %v\n", err)
+			return tree, fmt.Errorf("starting headless agent: %w", err)
 		}
-		l.Info(fmt.Sprintf("Created tmux window: %s\n", s))
-	} else {
-		s, err := tmux.CreateAndSwitchSession(cfg, worktreeName, prompt)
-		if err != nil {
-			exitWithError("Error creating tmux session: %v\n", err)
+		l.Info(fmt.Sprintf("Started headless agent, logging to %s\n", process.Log))
+		if cfg.NotifyIdle {
+			if err = watchForIdle(cfg, tree); err != nil {
+				l.Warn(fmt.Sprintf("Warning: %v\n", err))
+			}
+		}
+		l.Info(fmt.Sprintf("Created worktree: %s\n", worktreePath))
+		return tree, nil
+	}
+
+	target, err := m.CreateWorkspace(mux.Workspace{
+		Name:       tree.Session,
+		Dir:        worktreePath,
+		Command:    agent.Command,
+		Commands:   agent.Commands,
+		Window:     cfg.Window,
+		Background: !attach,
+	})
+	if err != nil {
+		return tree, fmt.Errorf("creating %s workspace: %w", m.Name(), err)
+	}
+	l.Info(fmt.Sprintf("Created %s workspace: %s\n", m.Name(), target.Name))
+
+	if prompt != "" {
+		// With a prompt the agent can get started on its own, so don't switch or attach to its session
+		if agent.PromptVia == config.PromptSendKeys {
+			if err = m.SendInput(target, prompt); err != nil {
+				return tree, fmt.Errorf("sending prompt: %w", err)
+			}
+		}
+	} else if attach && !cfg.Window {
+		if err = m.Switch(target); err != nil {
+			return tree, fmt.Errorf("switching to %s session: %w", m.Name(), err)
+		}
+	}
+
+	if cfg.NotifyIdle {
+		if err = watchForIdle(cfg, tree); err != nil {
+			l.Warn(fmt.Sprintf("Warning: %v\n", err))
 		}
-		l.Info(fmt.Sprintf("Created tmux session: %s\n", s))
 	}
 
 	l.Info(fmt.Sprintf("Created worktree: %s\n", worktreePath))
+	return tree, nil
+}
+
+// recordWorktree stores the facts about a new tree that later operations rely on. The returned tree
+// is usable even when recording fails. m is nil for headless trees.
+func recordWorktree(cfg *config.Config, m mux.Multiplexer, agent *agentLaunch, gitRoot, worktreePath, worktreeName, base, prompt string) (*registry.Tree, error) {
+	tree := &registry.Tree{
+		Name:           worktreeName,
+		Path:           worktreePath,
+		Repo:           gitRoot,
+		Branch:         worktreeName,
+		ExistingBranch: cfg.CheckoutExisting,
+		Base:           base,
+		From:           cfg.From,
+		Prompt:         prompt,
+		Agent:          agent.Name,
+		Bin:            agent.Command,
+		CreatedAt:      time.Now(),
+	}
+
+	var err error
+	if m != nil {
+		tree.Multiplexer = m.Name()
+		tree.Session = worktreeName
+		tree.Window = cfg.Window
+		if !cfg.Window {
+			if tree.Session, err = m.SessionName(gitRoot, worktreeName); err != nil {
+				return tree, err
+			}
+		}
+		if tree.OriginSession, err = m.CurrentSession(); err != nil {
+			return tree, err
+		}
+	}
+
+	if tree.RepoID, err = git.RepoID(gitRoot); err != nil {
+		return tree, err
+	}
+
+	return tree, registry.Update(cfg.Data, func(r *registry.Registry) error {
+		r.Put(tree)
+		return nil
+	})
 }
 
-func setupWorktreeDirectory(cfg *config.Config, worktreeName string) (string, error) {
-	dataDir := filepath.Join(cfg.Data)
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
+// lookupWorktree returns the registry entry for a worktree path, if one was recorded
+func lookupWorktree(cfg *config.Config, worktreePath string) (*registry.Tree, bool) {
+	r, err := registry.Load(cfg.Data)
+	if err != nil {
+		logger.Logger.Warn(fmt.Sprintf("Warning: failed to read registry: %v\n", err))
+		return nil, false
+	}
+	return r.Get(worktreePath)
+}
+
+func forgetWorktree(cfg *config.Config, worktreePath string) error {
+	return registry.Update(cfg.Data, func(r *registry.Registry) error {
+		r.Remove(worktreePath)
+		return nil
+	})
+}
+
+func setupWorktreeDirectory(cfg *config.Config, gitRoot, worktreeName string) (string, error) {
+	repoID, err := git.RepoID(gitRoot)
+	if err != nil {
+		return "", err
+	}
+
+	repoDir := cfg.RepoDir(repoID)
+	if err = os.MkdirAll(repoDir, 0755); err != nil {
 		return "", fmt.Errorf("error creating data directory: %w", err)
 	}
 
-	worktreePath := filepath.Join(dataDir, worktreeName)
-	if _, err := os.Stat(worktreePath); err == nil {
+	worktreePath := cfg.WorktreePath(repoID, worktreeName)
+	if _, err = os.Stat(worktreePath); err == nil {
 		return "", fmt.Errorf("worktree '%s' already exists", worktreeName)
 	}
 
 	return worktreePath, nil
 }
 
-func MergeWorktree(cfg *config.Config, worktreeName string) {
+// findWorktreePath returns the directory of an existing tree, preferring the per-repository
+// layout but still recognising trees created in the flat legacy layout
+func findWorktreePath(cfg *config.Config, gitRoot, worktreeName string) (string, error) {
+	commonDir, err := git.CommonDir(gitRoot)
+	if err != nil {
+		return "", err
+	}
+
+	repoID, err := git.RepoID(gitRoot)
+	if err != nil {
+		return "", err
+	}
+
+	worktreePath := cfg.WorktreePath(repoID, worktreeName)
+	if _, err = os.Stat(worktreePath); err == nil {
+		return worktreePath, nil
+	}
+
+	legacyPath := cfg.LegacyWorktreePath(worktreeName)
+	if gitDir, err := git.WorktreeGitDir(legacyPath); err == nil && isWithin(commonDir, gitDir) {
+		return legacyPath, nil
+	}
+
+	return worktreePath, nil
+}
+
+// DiscardWorktree abandons a tree without merging, removing its worktree, branch and session or window
+func DiscardWorktree(cfg *config.Config, worktreeName string, force bool) {
 	if cfg == nil {
 		cfg = config.New()
 	}
@@ -131,72 +353,142 @@ func MergeWorktree(cfg *config.Config, worktreeName string) {
 		exitWithError("Error: %v\n", err)
 	}
 
-	worktreePath := filepath.Join(cfg.Data, worktreeName)
-
-	if err = validateMergePrerequisites(gitRoot, worktreePath, worktreeName); err != nil {
+	worktreePath, err := findWorktreePath(cfg, gitRoot, worktreeName)
+	if err != nil {
 		exitWithError("Error: %v\n", err)
 	}
 
-	currentBranch, err := git.GetCurrentBranch(gitRoot)
-	if err != nil {
-		exitWithError("Error: %v\n", err)
+	tree, recorded := lookupWorktree(cfg, worktreePath)
+	if recorded {
+		gitRoot = tree.Repo
+	}
+
+	branchName := worktreeName
+	base := ""
+	keepBranch := false
+	if recorded {
+		branchName = tree.Branch
+		base = tree.Base
+		keepBranch = tree.ExistingBranch
+	}
+	if base == "" {
+		if base, err = git.GetCurrentBranch(gitRoot); err != nil {
+			exitWithError("Error: %v\n", err)
+		}
+	}
+
+	_, statErr := os.Stat(worktreePath)
+	worktreeExists := statErr == nil
+	// a branch is only deleted if it belongs to a recorded tree or the worktree being removed, so that a
+	// name like develop can't delete an unrelated branch
+	if !worktreeExists && !recorded {
+		exitWithError("Error: worktree '%s' does not exist\n", worktreeName)
+	}
+	if !recorded {
+		branchName = worktreeBranch(gitRoot, worktreePath)
+	}
+	branchExists := branchName != "" && git.BranchExists(gitRoot, branchName)
+
+	if !force {
+		if worktreeExists {
+			if dirty, err := git.HasUncommittedChanges(worktreePath); err == nil && dirty {
+				if !confirm(fmt.Sprintf("Worktree '%s' has uncommitted changes. Discard them?", worktreeName)) {
+					exitWithError("Aborted: use --force to discard without confirmation\n")
+				}
+			}
+		}
+		if branchExists && !keepBranch {
+			if ahead, _, err := git.AheadBehind(gitRoot, base, branchName); err == nil && ahead > 0 {
+				if !confirm(fmt.Sprintf("Branch '%s' has %d commit(s) not merged into %s. Delete it?", branchName, ahead, base)) {
+					exitWithError("Aborted: use --force to discard without confirmation\n")
+				}
+			}
+		}
 	}
 
-	l.Info(fmt.Sprintf("Rebasing on %s...\n", currentBranch))
-	if err = git.RebaseOnBranch(worktreePath, currentBranch); err != nil {
-		exitWithError("Error rebasing on %s: %v\n", currentBranch, err)
+	hookDir := gitRoot
+	if worktreeExists {
+		hookDir = worktreePath
+	}
+	hookTree := &registry.Tree{Name: worktreeName, Path: worktreePath, Repo: gitRoot, Branch: branchName, Base: base}
+	if err = runHooks(hookPreDiscard, cfg.Hooks.PreDiscard, hookDir, hookTree); err != nil {
+		exitWithError("Error: %v\n", err)
 	}
 
-	l.Info(fmt.Sprintf("Merging branch: %s\n", worktreeName))
-	if err = git.MergeBranch(gitRoot, worktreeName); err != nil {
-		exitWithError("Error merging branch %s: %v\n", worktreeName, err)
+	if err = killWorktreeSession(cfg, gitRoot, worktreeName, tree); err != nil {
+		l.Warn(fmt.Sprintf("Warning: %v\n", err))
 	}
 
-	l.Info(fmt.Sprintf("Removing worktree: %s\n", worktreePath))
-	if err = git.RemoveWorktree(gitRoot, worktreePath); err != nil {
-		exitWithError("Error removing worktree: %v\n", err)
+	if worktreeExists {
+		l.Info(fmt.Sprintf("Removing worktree: %s\n", worktreePath))
+		if err = git.ForceRemoveWorktree(gitRoot, worktreePath); err != nil {
+			exitWithError("Error removing worktree: %v\n", err)
+		}
+	} else if err = git.PruneWorktrees(gitRoot); err != nil {
+		l.Warn(fmt.Sprintf("Warning: %v\n", err))
 	}
 
-	l.Info(fmt.Sprintf("Deleting branch: %s\n", worktreeName))
-	if err = git.DeleteBranch(gitRoot, worktreeName); err != nil {
-		exitWithError("Error deleting branch %s: %v\n", worktreeName, err)
+	if branchExists && keepBranch {
+		l.Info(fmt.Sprintf("Keeping branch %s, which existed before the tree\n", branchName))
+	} else if branchExists {
+		l.Info(fmt.Sprintf("Deleting branch: %s\n", branchName))
+		if err = git.ForceDeleteBranch(gitRoot, branchName); err != nil {
+			exitWithError("Error deleting branch %s: %v\n", branchName, err)
+		}
 	}
 
-	sessionName, err := tmux.SessionName(gitRoot, worktreeName)
-	if err != nil {
-		l.Error(fmt.Sprintf("Warning: Could not determine tmux session name: %v\n", err))
-		return
-	} else {
-		l.Info(fmt.Sprintf("Killing tmux session: %s\n", sessionName))
-		if err = tmux.KillSession(sessionName); err != nil {
-			l.Error("Warning: Could not kill tmux session '%s': %v\n", sessionName, err)
-			return
+	if recorded {
+		if err = forgetWorktree(cfg, worktreePath); err != nil {
+			l.Warn(fmt.Sprintf("Warning: failed to update registry: %v\n", err))
 		}
 	}
 
-	l.Info(fmt.Sprintf("Successfully merged and cleaned up worktree: %s\n", worktreeName))
+	l.Info(fmt.Sprintf("Discarded worktree: %s\n", worktreeName))
 }
 
-func validateMergePrerequisites(gitRoot, worktreePath, worktreeName string) error {
-	hasChanges, err := git.HasUncommittedChanges(gitRoot)
+// worktreeBranch returns the branch checked out in the worktree at path, or "" if it is detached or git
+// doesn't know it as a worktree
+func worktreeBranch(gitRoot, path string) string {
+	worktrees, err := git.ListWorktrees(gitRoot)
 	if err != nil {
-		return fmt.Errorf("checking git status in root: %w", err)
+		return ""
 	}
-	if hasChanges {
-		return fmt.Errorf("uncommitted changes in git root. Please commit or stash changes first")
+	for _, wt := range worktrees {
+		if filepath.Clean(wt.Path) == filepath.Clean(path) || resolvePath(wt.Path) == resolvePath(path) {
+			return wt.Branch
+		}
 	}
+	return ""
+}
 
-	if _, err = os.Stat(worktreePath); os.IsNotExist(err) {
-		return fmt.Errorf("worktree '%s' does not exist", worktreeName)
+// killWorktreeSession kills the recorded session, window or headless agent for a tree, falling back to the derived session name
+func killWorktreeSession(cfg *config.Config, gitRoot, worktreeName string, tree *registry.Tree) error {
+	if tree != nil && tree.Headless != nil {
+		return stopHeadless(tree.Headless)
 	}
 
-	hasChanges, err = git.HasUncommittedChanges(worktreePath)
+	m, err := multiplexerFor(cfg, tree)
 	if err != nil {
-		return fmt.Errorf("checking git status in worktree: %w", err)
+		return err
+	}
+
+	target := mux.Target{}
+	if tree != nil {
+		target = treeTarget(tree)
 	}
-	if hasChanges {
-		return fmt.Errorf("uncommitted changes in worktree '%s'. Please commit or stash changes first", worktreeName)
+	if target.Name == "" {
+		if target.Name, err = m.SessionName(gitRoot, worktreeName); err != nil {
+			return fmt.Errorf("could not determine %s session name: %w", m.Name(), err)
+		}
 	}
 
+	kind := "session"
+	if target.Window {
+		kind = "window"
+	}
+	logger.Logger.Info(fmt.Sprintf("Killing %s %s: %s\n", m.Name(), kind, target.Name))
+	if err = m.Kill(target); err != nil {
+		return fmt.Errorf("could not kill %s %s '%s': %w", m.Name(), kind, target.Name, err)
+	}
 	return nil
 }
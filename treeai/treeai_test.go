@@ -1,9 +1,18 @@
 package treeai
 
 import (
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jesses-code-adventures/treeai/config"
+	"github.com/jesses-code-adventures/treeai/git"
+	"github.com/jesses-code-adventures/treeai/mux"
+	"github.com/jesses-code-adventures/treeai/registry"
 )
 
 //	func TestSetupWorktreeDirectory(t *testing.T) {
@@ -92,3 +101,797 @@ func TestValidateMergePrerequisites(t *testing.T) {
 		t.Error("validateMergePrerequisites() should return error for non-git directory")
 	}
 }
+
+func TestOrphanedDirectories(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "gc-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dataDir := filepath.Join(tmpDir, "data")
+	repoDir := filepath.Join(dataDir, "repo-0123456789ab")
+	commonDir := filepath.Join(tmpDir, "repo", ".git")
+	otherGitDir := filepath.Join(tmpDir, "other", ".git", "worktrees", "foreign")
+	for _, dir := range []string{
+		filepath.Join(repoDir, "known"),
+		filepath.Join(repoDir, "junk"),
+		filepath.Join(repoDir, "foreign"),
+		filepath.Join(repoDir, "stale"),
+		filepath.Join(dataDir, "legacy-known"),
+		filepath.Join(dataDir, "legacy-stale"),
+		filepath.Join(dataDir, "legacy-foreign"),
+		filepath.Join(dataDir, "other-repo-ba9876543210"),
+		filepath.Join(commonDir, "worktrees", "known"),
+		filepath.Join(commonDir, "worktrees", "legacy-known"),
+		otherGitDir,
+	} {
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gitFiles := map[string]string{
+		filepath.Join(repoDir, "known"):          filepath.Join(commonDir, "worktrees", "known"),
+		filepath.Join(repoDir, "foreign"):        otherGitDir,
+		filepath.Join(repoDir, "stale"):          filepath.Join(commonDir, "worktrees", "stale"),
+		filepath.Join(dataDir, "legacy-known"):   filepath.Join(commonDir, "worktrees", "legacy-known"),
+		filepath.Join(dataDir, "legacy-stale"):   filepath.Join(commonDir, "worktrees", "legacy-stale"),
+		filepath.Join(dataDir, "legacy-foreign"): otherGitDir,
+	}
+	for dir, gitDir := range gitFiles {
+		if err = os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+gitDir+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.WriteFile(filepath.Join(dataDir, "registry.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	known := map[string]bool{
+		filepath.Join(repoDir, "known"):        true,
+		filepath.Join(dataDir, "legacy-known"): true,
+	}
+	got, err := orphanedDirectories(repoDir, dataDir, commonDir, known)
+	if err != nil {
+		t.Fatalf("orphanedDirectories() error = %v", err)
+	}
+
+	want := []string{
+		filepath.Join(repoDir, "junk"),
+		filepath.Join(repoDir, "stale"),
+		filepath.Join(dataDir, "legacy-stale"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("orphanedDirectories() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("orphanedDirectories()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    MergeStrategy
+		wantErr bool
+	}{
+		{input: "", want: StrategyRebaseFF},
+		{input: "rebase-ff", want: StrategyRebaseFF},
+		{input: "squash", want: StrategySquash},
+		{input: "no-ff", want: StrategyNoFF},
+		{input: "cherry-pick", want: StrategyCherryPick},
+		{input: "octopus", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseStrategy(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseStrategy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderAgentCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		via      string
+		headless bool
+		prompt   string
+		want     string
+	}{
+		{"path and branch", "opencode {{.Path}} --title {{.Branch}}", config.PromptSendKeys, false, "fix it", "opencode '/data/feat' --title 'feat'"},
+		{"prompt appended as argument", "claude", config.PromptArg, false, "it's done", `claude 'it'\''s done'`},
+		{"prompt placed by template", "aider --message {{.Prompt}} --yes", config.PromptArg, false, "fix", "aider --message 'fix' --yes"},
+		{"no prompt", "claude", config.PromptArg, false, "", "claude"},
+		{"prompt file appended", "agent --file", config.PromptFile, false, "fix", "agent --file '/prompts/feat.md'"},
+		{"prompt file placed by template", "agent --file={{.PromptFile}} -v", config.PromptFile, false, "fix", "agent --file='/prompts/feat.md' -v"},
+		{"stdin redirected from prompt file", "agent -p", config.PromptStdin, false, "fix", "agent -p < '/prompts/feat.md'"},
+		{"headless stdin is piped by the supervisor", "agent -p", config.PromptStdin, true, "fix", "agent -p"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderAgentCommand(tt.template, tt.via, tt.headless, "/data/feat", "feat", tt.prompt, "/prompts/feat.md")
+			if err != nil {
+				t.Fatalf("renderAgentCommand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("renderAgentCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := renderAgentCommand("agent {{.Model}}", config.PromptArg, false, "/data/feat", "feat", "", ""); err == nil {
+		t.Error("renderAgentCommand() with an unknown field should fail")
+	}
+}
+
+func TestFanoutValidation(t *testing.T) {
+	cfg := config.New()
+	cfg.Data = t.TempDir()
+	cfg.Silent = true
+
+	if _, err := Fanout(cfg, "try", 0, nil, nil); err == nil {
+		t.Error("Fanout() with a count of 0 should fail")
+	}
+	// every agent is checked before any tree is created
+	if _, err := Fanout(cfg, "try", 2, []string{"claude", "missing"}, nil); err == nil {
+		t.Error("Fanout() with an unknown agent should fail")
+	}
+
+	// every prompt is rendered before any tree is created, each for its own tree
+	var names []string
+	_, err := Fanout(cfg, "try", 2, nil, func(name string) (string, error) {
+		names = append(names, name)
+		if name == "try-2" {
+			return "", fmt.Errorf("template failed")
+		}
+		return "fix " + name, nil
+	})
+	if err == nil || strings.Join(names, ",") != "try-1,try-2" {
+		t.Errorf("Fanout() with a failing prompt = %v after rendering %q, want try-1 and try-2 rendered and an error", err, names)
+	}
+	if entries, _ := os.ReadDir(cfg.Data); len(entries) > 0 {
+		t.Errorf("Fanout() created %d entries in the data directory before every prompt rendered", len(entries))
+	}
+}
+
+func TestCompareDetached(t *testing.T) {
+	cfg := newTestConfig(t)
+	root, path := newTreeRepo(t, cfg)
+	other := addTree(t, cfg, root, "other")
+	commitFile(t, path, "a.txt", "a\n", "add a")
+	runGit(t, other, "switch", "-q", "--detach")
+	commitFile(t, other, "b.txt", "b\n", "add b")
+
+	comparison, err := CompareWorktrees(cfg, []string{"feature", "other"})
+	if err != nil {
+		t.Fatalf("CompareWorktrees() error = %v", err)
+	}
+	detached := comparison.Trees[1]
+	if detached.Branch != "" || detached.Rev != runGit(t, other, "rev-parse", "HEAD") {
+		t.Errorf("detached tree = branch %q, rev %q, want it compared at its HEAD", detached.Branch, detached.Rev)
+	}
+	if strings.Join(comparison.Partial, ",") != "a.txt,b.txt" {
+		t.Errorf("CompareWorktrees() partial = %q, want each tree's own file", comparison.Partial)
+	}
+
+	diff, err := DiffWorktrees(cfg, "feature", "other")
+	if err != nil || !strings.Contains(diff, "b.txt") {
+		t.Errorf("DiffWorktrees() = %q, %v, want the detached tree's commit diffed", diff, err)
+	}
+}
+
+func TestMatchWorktrees(t *testing.T) {
+	statuses := []WorktreeStatus{{Name: "try-10"}, {Name: "try-2"}, {Name: "try"}, {Name: "try-1"}, {Name: "try-it"}, {Name: "retry-1"}}
+
+	names := func(matches []WorktreeStatus) []string {
+		var out []string
+		for _, m := range matches {
+			out = append(out, m.Name)
+		}
+		return out
+	}
+
+	if got := names(matchWorktrees(statuses, "try")); len(got) != 1 || got[0] != "try" {
+		t.Errorf("matchWorktrees() for an exact name = %v, want [try]", got)
+	}
+	if got := names(matchWorktrees(statuses[:2], "try")); len(got) != 2 || got[0] != "try-2" || got[1] != "try-10" {
+		t.Errorf("matchWorktrees() for a fan-out = %v, want [try-2 try-10]", got)
+	}
+	if got := matchWorktrees(statuses, "missing"); len(got) != 0 {
+		t.Errorf("matchWorktrees() for a missing name = %v, want none", names(got))
+	}
+}
+
+func TestObserveActivity(t *testing.T) {
+	cfg := config.New()
+	cfg.Data = t.TempDir()
+	cfg.IdleAfter = time.Hour
+	cfg.Agents["waits"] = config.Agent{Command: "waits", Ready: []string{`(?m)^ready>$`}}
+
+	log := filepath.Join(cfg.Data, "agent.log")
+	tree := &registry.Tree{Path: filepath.Join(cfg.Data, "tree"), Agent: "waits", Headless: &registry.Process{Log: log}}
+
+	if err := os.WriteFile(log, []byte("thinking...\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := observeActivity(cfg, tree); err != nil || got != ActivityWorking {
+		t.Errorf("observeActivity() with fresh output = %q, %v, want %q", got, err, ActivityWorking)
+	}
+
+	if err := os.WriteFile(log, []byte("done\nready>\n\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := observeActivity(cfg, tree); err != nil || got != ActivityIdle {
+		t.Errorf("observeActivity() at the ready prompt = %q, %v, want %q", got, err, ActivityIdle)
+	}
+
+	cfg.IdleAfter = 0
+	tree.Agent = "unknown --bin"
+	if err := os.WriteFile(log, []byte("thinking...\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := observeActivity(cfg, tree); err != nil || got != ActivityIdle {
+		t.Errorf("observeActivity() with settled output = %q, %v, want %q", got, err, ActivityIdle)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	tree := &registry.Tree{Name: "feature", Path: dir, Repo: dir, Branch: "feature", Base: "main"}
+
+	hooks := []string{`echo "$TREEAI_HOOK $TREEAI_NAME $TREEAI_BASE" > hook.out`}
+	if err := runHooks(hookPostCreate, hooks, dir, tree); err != nil {
+		t.Fatalf("runHooks() = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "hook.out")); string(got) != "post-create feature main\n" {
+		t.Errorf("hook wrote %q, want the hook point, tree name and base", got)
+	}
+
+	hooks = []string{"echo not ready; exit 3", "touch second.out"}
+	err := runHooks(hookPreMerge, hooks, dir, tree)
+	if err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Errorf("runHooks() with a failing hook = %v, want an error with its output", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(dir, "second.out")); statErr == nil {
+		t.Error("runHooks() should stop at the first failing hook")
+	}
+}
+
+func TestTreeBase(t *testing.T) {
+	dir := t.TempDir()
+	initRepo(t, dir)
+	runGit(t, dir, "branch", "dev")
+	runGit(t, dir, "tag", "v1")
+	runGit(t, dir, "update-ref", "refs/remotes/origin/dev", "HEAD")
+
+	tests := []struct {
+		from, base string
+		want       string
+		wantErr    bool
+	}{
+		{want: "main"},
+		{from: "dev", want: "dev"},
+		{from: "refs/heads/dev", want: "dev"},
+		{from: "origin/dev", want: "dev"},
+		{from: "v1", want: "main"},
+		{from: "v1", base: "dev", want: "dev"},
+		{base: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := treeBase(&config.Config{From: tt.from, Base: tt.base}, dir)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("treeBase(from %q, base %q) = %q, %v, want %q", tt.from, tt.base, got, err, tt.want)
+		}
+	}
+}
+
+func TestExistingBranch(t *testing.T) {
+	remote := t.TempDir()
+	dir := t.TempDir()
+	busy := filepath.Join(t.TempDir(), "busy")
+	initRepo(t, remote)
+	runGit(t, remote, "branch", "colleague")
+	initRepo(t, dir)
+	runGit(t, dir, "remote", "add", "origin", remote)
+	runGit(t, dir, "branch", "local")
+	runGit(t, dir, "worktree", "add", "-q", busy, "-b", "busy")
+	cfg := &config.Config{Data: t.TempDir()}
+
+	if upstream, err := existingBranch(cfg, dir, "local"); err != nil || upstream != "" {
+		t.Errorf("existingBranch(local) = %q, %v, want the local branch", upstream, err)
+	}
+	if upstream, err := existingBranch(cfg, dir, "colleague"); err != nil || upstream != "origin/colleague" {
+		t.Errorf("existingBranch(colleague) = %q, %v, want it fetched from origin", upstream, err)
+	}
+	if _, err := existingBranch(cfg, dir, "busy"); err == nil || !strings.Contains(err.Error(), busy) {
+		t.Errorf("existingBranch(busy) = %v, want an error naming the worktree it is checked out in", err)
+	}
+	if _, err := existingBranch(cfg, dir, "missing"); err == nil {
+		t.Error("existingBranch(missing) should fail")
+	}
+	if err := checkNewBranch(dir, "local"); err == nil || !strings.Contains(err.Error(), "--checkout-existing") {
+		t.Errorf("checkNewBranch(local) = %v, want it to suggest --checkout-existing", err)
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		commits  []string
+		want     []string
+	}{
+		{name: "squash lists each subject", strategy: StrategySquash, commits: []string{"add a", "add b"}, want: []string{"Squash merge branch 'feature'\n\n* add a\n* add b"}},
+		{name: "squash reuses a single message", strategy: StrategySquash, commits: []string{"add a"}, want: []string{"add a"}},
+		{name: "cherry-pick copies each commit", strategy: StrategyCherryPick, commits: []string{"add a", "add b"}, want: []string{"add b", "add a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			cfg.Strategy = string(tt.strategy)
+			root, path := newTreeRepo(t, cfg)
+			commitFile(t, root, "main.txt", "main\n", "advance main")
+			for i, subject := range tt.commits {
+				commitFile(t, path, string(rune('a'+i))+".txt", subject+"\n", subject)
+			}
+
+			MergeWorktree(cfg, "feature", "", false)
+
+			var got []string
+			for i := range tt.want {
+				got = append(got, runGit(t, root, "log", "-1", "--format=%B", fmt.Sprintf("HEAD~%d", i)))
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("commit messages on main = %q, want %q", got, tt.want)
+			}
+			if parents := strings.Fields(runGit(t, root, "rev-list", "--parents", "-1", "HEAD")); len(parents) != 2 {
+				t.Errorf("HEAD has %d parents, want a single parent", len(parents)-1)
+			}
+			for i := range tt.commits {
+				if _, err := os.Stat(filepath.Join(root, string(rune('a'+i))+".txt")); err != nil {
+					t.Errorf("merged file missing from main: %v", err)
+				}
+			}
+			if git.BranchExists(root, "feature") {
+				t.Error("MergeWorktree() should delete the branch after rewriting its commits")
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("MergeWorktree() should remove the worktree, stat = %v", err)
+			}
+		})
+	}
+}
+
+func TestMergeInto(t *testing.T) {
+	cfg := newTestConfig(t)
+	root, path := newTreeRepo(t, cfg)
+	commitFile(t, path, "a.txt", "a\n", "add a")
+	runGit(t, root, "switch", "-q", "-c", "develop")
+
+	if !exits(t, func() { MergeWorktree(cfg, "feature", "", false) }) {
+		t.Fatal("MergeWorktree() should refuse to switch the git root to the tree's base on its own")
+	}
+	if got := runGit(t, root, "branch", "--show-current"); got != "develop" {
+		t.Errorf("git root is on %q, want it left on develop", got)
+	}
+	if loadTree(t, cfg, path) == nil {
+		t.Error("MergeWorktree() should keep the tree when it refuses to merge")
+	}
+
+	MergeWorktree(cfg, "feature", "main", false)
+	if got := runGit(t, root, "branch", "--show-current"); got != "main" {
+		t.Errorf("git root is on %q, want main", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.txt")); err != nil {
+		t.Errorf("merged file missing from main: %v", err)
+	}
+}
+
+func TestMergeContinue(t *testing.T) {
+	cfg := newTestConfig(t)
+	root, path := newTreeRepo(t, cfg)
+	commitFile(t, root, "shared.txt", "main\n", "main change")
+	commitFile(t, path, "shared.txt", "tree\n", "tree change")
+
+	if !exits(t, func() { MergeWorktree(cfg, "feature", "", false) }) {
+		t.Fatal("MergeWorktree() should stop on the conflict in the tree")
+	}
+	state := loadTree(t, cfg, path).Merge
+	if state == nil || state.Step != mergeStepSync || strings.Join(state.Conflicts, ",") != "shared.txt" {
+		t.Fatalf("paused merge = %+v, want the sync step stopped on shared.txt", state)
+	}
+	if !exits(t, func() { MergeWorktree(cfg, "feature", "", false) }) {
+		t.Error("MergeWorktree() should refuse to start while a merge is already in progress")
+	}
+
+	// the base branch moves on while the tree's conflict is resolved, so bringing the tree in conflicts again
+	resolveFile(t, path, "shared.txt", "resolved\n")
+	commitFile(t, root, "shared.txt", "main again\n", "another main change")
+	if !exits(t, func() { ContinueMerge(cfg, "feature", false) }) {
+		t.Fatal("ContinueMerge() should stop on the conflict in the git root")
+	}
+	if state = loadTree(t, cfg, path).Merge; state == nil || state.Step != mergeStepMerge {
+		t.Fatalf("paused merge = %+v, want the merge step", state)
+	}
+
+	resolveFile(t, root, "shared.txt", "final\n")
+	if exits(t, func() { ContinueMerge(cfg, "feature", false) }) {
+		t.Fatal("ContinueMerge() failed once the conflicts were resolved")
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(root, "shared.txt")); string(got) != "final\n" {
+		t.Errorf("shared.txt on main = %q, want the resolution", got)
+	}
+	if git.BranchExists(root, "feature") || loadTree(t, cfg, path) != nil {
+		t.Error("ContinueMerge() should clean up the branch and registry entry once merged")
+	}
+	if !exits(t, func() { ContinueMerge(cfg, "feature", false) }) {
+		t.Error("ContinueMerge() should fail when no merge is in progress")
+	}
+}
+
+func TestAbortMerge(t *testing.T) {
+	for _, step := range []string{mergeStepSync, mergeStepMerge} {
+		t.Run(step, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			root, path := newTreeRepo(t, cfg)
+			commitFile(t, root, "shared.txt", "main\n", "main change")
+			commitFile(t, path, "shared.txt", "tree\n", "tree change")
+			runGit(t, root, "switch", "-q", "-c", "other")
+			rootHead := runGit(t, root, "rev-parse", "main")
+			treeHead := runGit(t, path, "rev-parse", "HEAD")
+
+			if !exits(t, func() { AbortMerge(cfg, "feature") }) {
+				t.Error("AbortMerge() should fail when no merge is in progress")
+			}
+			if !exits(t, func() { MergeWorktree(cfg, "feature", "main", false) }) {
+				t.Fatal("MergeWorktree() should stop on the conflict in the tree")
+			}
+			if step == mergeStepMerge {
+				resolveFile(t, path, "shared.txt", "resolved\n")
+				commitFile(t, root, "shared.txt", "main again\n", "another main change")
+				if !exits(t, func() { ContinueMerge(cfg, "feature", false) }) {
+					t.Fatal("ContinueMerge() should stop on the conflict in the git root")
+				}
+			}
+			if state := loadTree(t, cfg, path).Merge; state == nil || state.Step != step {
+				t.Fatalf("paused merge = %+v, want the %s step", state, step)
+			}
+
+			if exits(t, func() { AbortMerge(cfg, "feature") }) {
+				t.Fatal("AbortMerge() failed")
+			}
+			if got := runGit(t, path, "rev-parse", "HEAD"); got != treeHead || git.RebaseInProgress(path) {
+				t.Errorf("tree HEAD = %s, want it restored to %s with no rebase in progress", got, treeHead)
+			}
+			if got := runGit(t, root, "rev-parse", "main"); got != rootHead || git.MergeInProgress(root) {
+				t.Errorf("main = %s, want it restored to %s with no merge in progress", got, rootHead)
+			}
+			if got := runGit(t, root, "branch", "--show-current"); got != "other" {
+				t.Errorf("git root is on %s, want it switched back to other", got)
+			}
+			if tree := loadTree(t, cfg, path); tree == nil || tree.Merge != nil {
+				t.Errorf("tree after abort = %+v, want it kept with no merge recorded", tree)
+			}
+		})
+	}
+}
+
+func TestDiscardWorktree(t *testing.T) {
+	tests := []struct {
+		name        string
+		dirty       bool
+		commit      bool
+		force       bool
+		answer      bool
+		wantPrompts int
+		wantKept    bool
+	}{
+		{name: "clean tree is discarded without asking"},
+		{name: "dirty tree asks first", dirty: true, answer: true, wantPrompts: 1},
+		{name: "declining keeps a dirty tree", dirty: true, wantPrompts: 1, wantKept: true},
+		{name: "unmerged commits ask first", commit: true, answer: true, wantPrompts: 1},
+		{name: "declining keeps unmerged commits", commit: true, wantPrompts: 1, wantKept: true},
+		{name: "force skips asking", dirty: true, commit: true, force: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig(t)
+			root, path := newTreeRepo(t, cfg)
+			if tt.commit {
+				commitFile(t, path, "a.txt", "a\n", "add a")
+			}
+			if tt.dirty {
+				if err := os.WriteFile(filepath.Join(path, "b.txt"), []byte("b\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			questions := answer(t, tt.answer)
+
+			exited := exits(t, func() { DiscardWorktree(cfg, "feature", tt.force) })
+			if len(*questions) != tt.wantPrompts {
+				t.Errorf("DiscardWorktree() asked %q, want %d question(s)", *questions, tt.wantPrompts)
+			}
+			if exited != tt.wantKept {
+				t.Errorf("DiscardWorktree() exited = %v, want %v", exited, tt.wantKept)
+			}
+			_, statErr := os.Stat(path)
+			kept := statErr == nil && git.BranchExists(root, "feature") && loadTree(t, cfg, path) != nil
+			removed := os.IsNotExist(statErr) && !git.BranchExists(root, "feature") && loadTree(t, cfg, path) == nil
+			if tt.wantKept && !kept || !tt.wantKept && !removed {
+				t.Errorf("after DiscardWorktree() kept = %v, removed = %v, want kept %v", kept, removed, tt.wantKept)
+			}
+		})
+	}
+
+	t.Run("plain branch without a tree is kept", func(t *testing.T) {
+		cfg := newTestConfig(t)
+		root, _ := newTreeRepo(t, cfg)
+		runGit(t, root, "branch", "develop")
+
+		if !exits(t, func() { DiscardWorktree(cfg, "develop", true) }) {
+			t.Error("DiscardWorktree() should fail for a branch that isn't a tree")
+		}
+		if !git.BranchExists(root, "develop") {
+			t.Error("DiscardWorktree() deleted a branch that doesn't belong to a tree")
+		}
+	})
+
+	t.Run("unrecorded worktree takes its branch with it", func(t *testing.T) {
+		cfg := newTestConfig(t)
+		root, path := newTreeRepo(t, cfg)
+		if err := forgetWorktree(cfg, path); err != nil {
+			t.Fatal(err)
+		}
+
+		if exits(t, func() { DiscardWorktree(cfg, "feature", true) }) {
+			t.Fatal("DiscardWorktree() failed for an unrecorded worktree")
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) || git.BranchExists(root, "feature") {
+			t.Errorf("DiscardWorktree() should remove the worktree and its branch, stat = %v", err)
+		}
+	})
+
+	t.Run("registry-only entry is forgotten", func(t *testing.T) {
+		cfg := newTestConfig(t)
+		root, path := newTreeRepo(t, cfg)
+		runGit(t, root, "worktree", "remove", path)
+		runGit(t, root, "branch", "-D", "feature")
+		questions := answer(t, false)
+
+		if exits(t, func() { DiscardWorktree(cfg, "feature", false) }) {
+			t.Fatal("DiscardWorktree() failed for a tree only left in the registry")
+		}
+		if len(*questions) != 0 || loadTree(t, cfg, path) != nil {
+			t.Errorf("DiscardWorktree() asked %q and left %+v, want the entry forgotten without asking", *questions, loadTree(t, cfg, path))
+		}
+	})
+}
+
+func TestExistingBranchKept(t *testing.T) {
+	// openExisting records the feature tree as opened with --checkout-existing, with a commit only on its branch
+	openExisting := func(t *testing.T) (*config.Config, string, string) {
+		cfg := newTestConfig(t)
+		root, path := newTreeRepo(t, cfg)
+		cfg.CheckoutExisting = true
+		tree, err := recordWorktree(cfg, nil, &agentLaunch{Name: "opencode"}, root, path, "feature", "main", "")
+		if err != nil || !tree.ExistingBranch {
+			t.Fatalf("recordWorktree() = %+v, %v, want the branch recorded as existing", tree, err)
+		}
+		commitFile(t, path, "a.txt", "a\n", "unpushed work")
+		return cfg, root, path
+	}
+
+	t.Run("discard", func(t *testing.T) {
+		cfg, root, path := openExisting(t)
+		questions := answer(t, false)
+		if exits(t, func() { DiscardWorktree(cfg, "feature", true) }) {
+			t.Fatal("DiscardWorktree() failed")
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) || loadTree(t, cfg, path) != nil {
+			t.Errorf("DiscardWorktree() should remove the worktree and registry entry, stat = %v", err)
+		}
+		if !git.BranchExists(root, "feature") || len(*questions) != 0 {
+			t.Errorf("DiscardWorktree() asked %q, want the existing branch kept without asking", *questions)
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		cfg, root, path := openExisting(t)
+		MergeWorktree(cfg, "feature", "", false)
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("MergeWorktree() should remove the worktree, stat = %v", err)
+		}
+		if !git.BranchExists(root, "feature") {
+			t.Error("MergeWorktree() should keep the existing branch")
+		}
+	})
+
+	t.Run("gc", func(t *testing.T) {
+		cfg, root, path := openExisting(t)
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+		debris, err := FindDebris(cfg, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range debris {
+			if d.Kind == "branch" {
+				t.Errorf("FindDebris() = %q, want the existing branch left alone", d.Description)
+			}
+			if err = d.Fix(); err != nil {
+				t.Errorf("fixing %q: %v", d.Description, err)
+			}
+		}
+		if !git.BranchExists(root, "feature") || loadTree(t, cfg, path) != nil {
+			t.Error("gc should forget the tree but keep its existing branch")
+		}
+	})
+}
+
+func TestSessionPath(t *testing.T) {
+	reg := &registry.Registry{Trees: map[string]*registry.Tree{
+		"/data/repo/feature": {Path: "/data/repo/feature", Session: "repo-feature", Multiplexer: "screen"},
+		"/data/repo/other":   {Path: "/data/repo/other", Session: "repo-other", Multiplexer: "tmux"},
+	}}
+	tests := []struct {
+		name        string
+		multiplexer string
+		session     mux.Session
+		want        string
+	}{
+		{"reported path is used", "tmux", mux.Session{Name: "repo-other", Path: "/elsewhere"}, "/elsewhere"},
+		{"screen session resolved from the registry", "screen", mux.Session{Name: "repo-feature"}, "/data/repo/feature"},
+		{"other multiplexer's tree is ignored", "screen", mux.Session{Name: "repo-other"}, ""},
+		{"unknown session", "screen", mux.Session{Name: "scratch"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionPath(reg, tt.multiplexer, tt.session); got != tt.want {
+				t.Errorf("sessionPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// initRepo makes dir a git repository on main with a single empty commit
+func initRepo(t *testing.T, dir string) {
+	t.Helper()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	runGit(t, dir, "config", "user.name", "test")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", "init")
+}
+
+// runGit runs git in dir, failing the test if it fails, and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// newTestConfig returns a config keeping its data in a temporary directory
+func newTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := config.New()
+	cfg.Data = t.TempDir()
+	cfg.Silent = true
+	return cfg
+}
+
+// newTreeRepo makes a repository on main the working directory, with a tree named feature recorded in cfg's
+// data directory, and returns the repository and the tree's path
+func newTreeRepo(t *testing.T, cfg *config.Config) (string, string) {
+	t.Helper()
+	// keep conflict windows from being opened in the tmux session running the tests
+	t.Setenv("TMUX", "")
+
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	initRepo(t, root)
+	t.Chdir(root)
+	return root, addTree(t, cfg, root, "feature")
+}
+
+// addTree adds a worktree on a new branch from main and records it as a tree, as creating it would
+func addTree(t *testing.T, cfg *config.Config, root, name string) string {
+	t.Helper()
+	repoID, err := git.RepoID(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := cfg.WorktreePath(repoID, name)
+	runGit(t, root, "worktree", "add", "-q", "-b", name, path, "main")
+
+	err = registry.Update(cfg.Data, func(r *registry.Registry) error {
+		r.Put(&registry.Tree{Name: name, Path: path, Repo: root, Branch: name, Base: "main", CreatedAt: time.Now()})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// commitFile writes content to name in dir and commits it
+func commitFile(t *testing.T, dir, name, content, message string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-q", "-m", message)
+}
+
+// resolveFile settles a conflicted file with content and stages it
+func resolveFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", name)
+}
+
+// exits runs fn and reports whether it exited through exitWithError
+func exits(t *testing.T, fn func()) (exited bool) {
+	t.Helper()
+	type exitCode int
+	osExit = func(code int) { panic(exitCode(code)) }
+	defer func() {
+		osExit = os.Exit
+		if r := recover(); r != nil {
+			if _, ok := r.(exitCode); !ok {
+				panic(r)
+			}
+			exited = true
+		}
+	}()
+
+	fn()
+	return false
+}
+
+// loadTree returns the tree recorded at path in cfg's registry, or nil if there is none
+func loadTree(t *testing.T, cfg *config.Config, path string) *registry.Tree {
+	t.Helper()
+	r, err := registry.Load(cfg.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := r.Get(path)
+	return tree
+}
+
+// answer replies yes or no to every confirmation in place of the user, returning the questions asked
+func answer(t *testing.T, yes bool) *[]string {
+	t.Helper()
+	var questions []string
+	previous := confirm
+	confirm = func(question string) bool {
+		questions = append(questions, question)
+		return yes
+	}
+	t.Cleanup(func() { confirm = previous })
+	return &questions
+}